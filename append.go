@@ -2,125 +2,254 @@ package bytebuf
 
 import (
 	"io"
+	"sort"
+	"sync/atomic"
 )
 
 // Append appends one ByteBuf to another. The original buffers are unmodified.
+//
+// The returned ByteBuf takes ownership of both buffers, and closing it will
+// close them. To use the same buffer in multiple calls to Append, pass each
+// call a separate handle from Retain.
+//
+// Appending to a buffer returned from Append does not nest the buffers;
+// instead, the result contains a flat list of all the underlying buffers, so
+// that appending repeatedly in a loop doesn't result in a deeply-nested
+// buffer.
 func Append(one, two ByteBuf) ByteBuf {
-	if s2, ok := two.(*sliceBuf); ok {
+	// Note that sliceBufs that refer to an underlying resource can't be
+	// coalesced, since each needs to release its own reference on Close.
+	if s2, ok := two.(*sliceBuf); ok && s2.ref == nil {
 		// If the first buffer is also a sliceBuf, then we can return a
 		// single sliceBuf that contains everything.
-		if s1, ok := one.(*sliceBuf); ok {
-			ret := &sliceBuf{}
-			ret.slices = append(ret.slices, s1.slices...)
-			ret.slices = append(ret.slices, s2.slices...)
-			return ret
+		if s1, ok := one.(*sliceBuf); ok && s1.ref == nil {
+			slices := make([][]byte, 0, len(s1.slices)+len(s2.slices))
+			slices = append(slices, s1.slices...)
+			slices = append(slices, s2.slices...)
+			return newSliceBuf(slices)
 		}
+	}
 
-		// If the first buffer is a combinedBuf itself, and the second
-		// buffer there is a slice, then we can unwrap and combine
-		// them. Essentially:
-		//     (X, slice) + slice = (X, slice + slice)
-		//
-		// This is helpful because it allows us to avoid an unnecessary
-		// layer of nesting.
-		//
-		// TODO: we should expand combinedBuf to handle an arbitrary
-		// array of buffers.
-		if s1, ok := one.(*combinedBuf); ok {
-			if s12, ok := s1.two.(*sliceBuf); ok {
-				ret := &sliceBuf{}
-				ret.slices = append(ret.slices, s12.slices...)
-				ret.slices = append(ret.slices, s2.slices...)
-
-				return &combinedBuf{s1.one, ret}
-			}
+	// Flatten any combinedBufs into their underlying buffers; since we
+	// own both buffers, we can take ownership of their children.
+	var (
+		left  *combinedBuf
+		right []ByteBuf
+	)
+	if c1, ok := one.(*combinedBuf); ok {
+		left = c1
+	} else {
+		left = newCombinedBuf([]ByteBuf{one})
+	}
+	if c2, ok := two.(*combinedBuf); ok {
+		right = c2.bufs
+	} else {
+		right = []ByteBuf{two}
+	}
+
+	// If the buffers on either side of the join are both sliceBufs, then
+	// we can coalesce them. Essentially:
+	//     (X, slice) + (slice, Y) = (X, slice + slice, Y)
+	if len(left.bufs) > 0 && len(right) > 0 {
+		last := len(left.bufs) - 1
+		s1, ok1 := left.bufs[last].(*sliceBuf)
+		s2, ok2 := right[0].(*sliceBuf)
+		if ok1 && ok2 && s1.ref == nil && s2.ref == nil {
+			merged := Append(s1, s2)
+
+			bufs := make([]ByteBuf, 0, len(left.bufs)+len(right))
+			bufs = append(bufs, left.bufs[:last]...)
+			bufs = append(bufs, merged)
+			bufs = append(bufs, right[1:]...)
+			return newCombinedBuf(bufs)
 		}
 	}
 
-	return &combinedBuf{one, two}
+	return left.appendBufs(right)
 }
 
+// combinedBuf is a ByteBuf made up of a flat list of other ByteBufs, none of
+// which are themselves combinedBufs.
 type combinedBuf struct {
-	one, two ByteBuf
+	bufs []ByteBuf
+
+	// offsets contains the offset of each buffer in bufs within this
+	// buffer, followed by the total length.
+	offsets []int64
+
+	// extended is set once appendBufs has (potentially) used the spare
+	// capacity of bufs and offsets; see appendBufs.
+	extended uint32
+
+	digestCache
 }
 
+var _ ByteBuf = (*combinedBuf)(nil)
+
+func newCombinedBuf(bufs []ByteBuf) *combinedBuf {
+	ret := &combinedBuf{
+		bufs:    bufs,
+		offsets: make([]int64, 1, len(bufs)+1),
+	}
+	for _, buf := range bufs {
+		ret.offsets = append(ret.offsets, ret.Length()+buf.Length())
+	}
+	return ret
+}
+
+// appendBufs returns a new combinedBuf containing all buffers in b, followed by
+// the provided buffers.
+func (b *combinedBuf) appendBufs(bufs []ByteBuf) *combinedBuf {
+	ret := &combinedBuf{}
+
+	// The first time that we append to a combinedBuf, we can use any spare
+	// capacity in its slices, since nothing else refers to that memory;
+	// this means that appending to a buffer repeatedly in a loop takes
+	// amortized constant time. Any subsequent appends to the same buffer
+	// need to copy the slices.
+	if atomic.CompareAndSwapUint32(&b.extended, 0, 1) {
+		ret.bufs = b.bufs
+		ret.offsets = b.offsets
+	} else {
+		ret.bufs = b.bufs[:len(b.bufs):len(b.bufs)]
+		ret.offsets = b.offsets[:len(b.offsets):len(b.offsets)]
+	}
+
+	for _, buf := range bufs {
+		ret.bufs = append(ret.bufs, buf)
+		ret.offsets = append(ret.offsets, ret.Length()+buf.Length())
+	}
+	return ret
+}
+
+// Length implements ByteBuf
 func (b *combinedBuf) Length() int64 {
-	return b.one.Length() + b.two.Length()
+	return b.offsets[len(b.offsets)-1]
 }
 
 // AsReader implements ByteBuf
-func (b *combinedBuf) AsReader() io.Reader {
-	return io.MultiReader(b.one.AsReader(), b.two.AsReader())
+func (b *combinedBuf) AsReader() *Reader {
+	return NewReader(b)
 }
 
 // WriteTo implements io.WriterTo
 func (b *combinedBuf) WriteTo(w io.Writer) (n int64, err error) {
-	n1, err := b.one.WriteTo(w)
-	if err != nil {
-		return n1, err
+	// Gather the slices from adjacent in-memory buffers, so that we can
+	// write them with a single vectored write; other buffers are written
+	// with their own WriteTo implementation, so that they can use any
+	// optimizations that they support (e.g. sendfile).
+	var (
+		slices [][]byte
+		currN  int64
+	)
+	for _, buf := range b.bufs {
+		if s, ok := buf.(*sliceBuf); ok {
+			slices = append(slices, s.slices...)
+			continue
+		}
+
+		if len(slices) > 0 {
+			currN, err = writeSlices(w, slices)
+			n += currN
+			if err != nil {
+				return
+			}
+			slices = slices[:0]
+		}
+
+		currN, err = buf.WriteTo(w)
+		n += currN
+		if err != nil {
+			return
+		}
 	}
 
-	n2, err := b.two.WriteTo(w)
-	if err != nil {
-		return n1 + n2, err
+	if len(slices) > 0 {
+		currN, err = writeSlices(w, slices)
+		n += currN
 	}
+	return
+}
 
-	return n1 + n2, nil
+// find returns the index of the buffer containing the given offset, or
+// len(b.bufs) if the offset is past the end of this buffer.
+func (b *combinedBuf) find(off int64) int {
+	return sort.Search(len(b.bufs), func(i int) bool {
+		return b.offsets[i+1] > off
+	})
 }
 
 // ReadAt implements io.ReaderAt
 func (b *combinedBuf) ReadAt(p []byte, off int64) (int, error) {
-	oneLen := b.one.Length()
-	//twoLen := b.two.Length()
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+
+	// Find the first buffer that contains our data, then read from each
+	// buffer in turn until we fill p or run out of buffers.
+	copied := 0
+	for i := b.find(off); i < len(b.bufs) && len(p) > 0; i++ {
+		bufOff := off - b.offsets[i]
+		want := b.offsets[i+1] - off
+		if want > int64(len(p)) {
+			want = int64(len(p))
+		}
 
-	// Handle the case where the buffer falls entirely in the first or second
-	// buffer.
-	endPos := off + int64(len(p))
-	if off < oneLen && endPos <= oneLen {
-		return b.one.ReadAt(p, off)
+		n, err := b.bufs[i].ReadAt(p[:want], bufOff)
+		copied += n
+		off += int64(n)
+		p = p[n:]
+
+		// Note: io.ReaderAt specifies that this can return io.EOF even
+		// if it reads all the data; ignore that error unless we got
+		// less data than expected.
+		if err != nil && (err != io.EOF || int64(n) < want) {
+			return copied, err
+		}
 	}
-	if off >= oneLen {
-		return b.two.ReadAt(p, off-oneLen)
+
+	if len(p) != 0 {
+		return copied, io.EOF
 	}
+	return copied, nil
+}
 
-	// If we get here, the buffer spans the two underlying buffers.
-	//
-	// <------- one.length -------><------- two.length ------->
-	//                  off <---- len(p) ---->
-	//                      ^     ^^         ^
-	//                      |     ||         |
-	//                      +--+--++----+----+
-	//                         |        |
-	//                         a        b
-	//
-	// As you can see from the diagram above, there's two components: a and
-	// b. We can calculate the midpoint from:
-	//
-	//    a = one.length - off
-	aLen := oneLen - off
+// Section implements ByteBuf
+func (b *combinedBuf) Section(off, n int64) ByteBuf {
+	off, n = clampSection(off, n, b.Length())
+	if n == 0 {
+		return Empty()
+	}
 
-	n1, err := b.one.ReadAt(p[:aLen], off)
+	// Collect sections of all the underlying buffers that overlap with
+	// the requested range.
+	var bufs []ByteBuf
+	end := off + n
+	for i := b.find(off); i < len(b.bufs) && b.offsets[i] < end; i++ {
+		start, stop := b.offsets[i], b.offsets[i+1]
+		if start < off {
+			start = off
+		}
+		if stop > end {
+			stop = end
+		}
 
-	// Note: io.ReaderAt specifies that this can return io.EOF; ignore that
-	// error.
-	if err != nil && err != io.EOF {
-		return n1, err
+		bufs = append(bufs, b.bufs[i].Section(start-b.offsets[i], stop-start))
 	}
 
-	n2, err := b.two.ReadAt(p[aLen:], 0)
-	if err != nil {
-		return n1 + n2, err
+	if len(bufs) == 1 {
+		return bufs[0]
 	}
-
-	return n1 + n2, nil
+	return newCombinedBuf(bufs)
 }
 
 // Close implements io.Closer
 func (b *combinedBuf) Close() error {
-	e1 := b.one.Close()
-	e2 := b.two.Close()
-	if e1 != nil {
-		return e1
+	var err error
+	for _, buf := range b.bufs {
+		if cerr := buf.Close(); err == nil {
+			err = cerr
+		}
 	}
-	return e2
+	return err
 }
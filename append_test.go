@@ -1,7 +1,10 @@
 package bytebuf
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -19,7 +22,7 @@ func TestCombinedBuf(t *testing.T) {
 			buf2 := NewFromSlice([]byte(expected[offset:]))
 
 			// Note: can't use Append here since that special-cases bytes
-			combined := &combinedBuf{buf1, buf2}
+			combined := newCombinedBuf([]ByteBuf{buf1, buf2})
 
 			testByteBufImpl(t, combined, expected)
 		})
@@ -47,7 +50,7 @@ func TestAppend(t *testing.T) {
 		buf2 := NewFromSlice([]byte("bar"))
 
 		// NOTE: don't use Append here to avoid coalescing.
-		combined := &combinedBuf{buf1, buf2}
+		combined := newCombinedBuf([]ByteBuf{buf1, buf2})
 
 		buf3 := NewFromSlice([]byte("baz"))
 		combined2 := Append(combined, buf3)
@@ -56,7 +59,8 @@ func TestAppend(t *testing.T) {
 		if assert.True(t, ok) {
 			// The second item inside the combined buf should be a
 			// slice buf that has the last two slices coalesced.
-			if slice2, ok := slice.two.(*sliceBuf); assert.True(t, ok) {
+			require.Len(t, slice.bufs, 2)
+			if slice2, ok := slice.bufs[1].(*sliceBuf); assert.True(t, ok) {
 				assert.Equal(t, [][]byte{
 					[]byte("bar"),
 					[]byte("baz"),
@@ -82,3 +86,128 @@ func TestAppend(t *testing.T) {
 		testByteBufImpl(t, combined, "foobar")
 	})
 }
+
+func TestAppendFlattens(t *testing.T) {
+	f := makeTempFile(t, "file")
+	fbuf, err := NewFromFile(f)
+	require.NoError(t, err)
+	defer fbuf.Close()
+
+	// Append thousands of pieces, alternating between buffer types so
+	// that nothing is coalesced.
+	var (
+		buf      = Empty()
+		expected strings.Builder
+	)
+	for i := 0; i < 5000; i++ {
+		var piece ByteBuf
+		switch i % 3 {
+		case 0:
+			piece = NewFromString(fmt.Sprintf("slice%d,", i))
+		case 1:
+			piece = Retain(fbuf)
+		case 2:
+			piece = NewFromBytesReader(bytes.NewReader([]byte(fmt.Sprintf("reader%d,", i))))
+		}
+
+		expected.WriteString(mustReadAll(t, piece))
+		buf = Append(buf, piece)
+	}
+	defer buf.Close()
+
+	combined, ok := buf.(*combinedBuf)
+	require.True(t, ok)
+	for _, child := range combined.bufs {
+		_, nested := child.(*combinedBuf)
+		assert.False(t, nested)
+	}
+
+	data, err := ReadAll(buf)
+	require.NoError(t, err)
+	assert.Equal(t, expected.String(), string(data))
+
+	// Read from a number of offsets, spanning multiple buffers.
+	exp := expected.String()
+	for off := 0; off < len(exp); off += 997 {
+		p := make([]byte, 50)
+		if off+len(p) > len(exp) {
+			p = p[:len(exp)-off]
+		}
+
+		n, err := buf.ReadAt(p, int64(off))
+		require.NoError(t, err)
+		assert.Equal(t, exp[off:off+n], string(p))
+	}
+}
+
+func TestAppendShared(t *testing.T) {
+	// Appending multiple times to the same buffer must not cause the
+	// results to share data.
+	base := Append(NewFromString("foo"), NewFromBytesReader(bytes.NewReader([]byte("bar"))))
+
+	one := Append(base, NewFromBytesReader(bytes.NewReader([]byte("one"))))
+	two := Append(base, NewFromBytesReader(bytes.NewReader([]byte("two"))))
+
+	assert.Equal(t, "foobarone", mustReadAll(t, one))
+	assert.Equal(t, "foobartwo", mustReadAll(t, two))
+	assert.Equal(t, "foobar", mustReadAll(t, base))
+}
+
+func mustReadAll(t *testing.T, buf ByteBuf) string {
+	data, err := ReadAll(buf)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestCombinedBufGatherWrite(t *testing.T) {
+	f := makeTempFile(t, "file")
+	fbuf, err := NewFromFile(f)
+	require.NoError(t, err)
+
+	// Construct this directly, to prevent the adjacent slices from being
+	// coalesced.
+	combined := newCombinedBuf([]ByteBuf{
+		NewFromString("header,"),
+		NewFromSlices([]byte("one,"), []byte("two,")),
+		fbuf,
+		NewFromString(",trailer"),
+		NewFromString(",end"),
+	})
+
+	const expected = "header,one,two,file,trailer,end"
+	t.Run("Impl", func(t *testing.T) {
+		testByteBufImpl(t, Retain(combined), expected)
+	})
+
+	// When a write fails partway through, we should get the exact number
+	// of bytes that were written.
+	for _, limit := range []int{0, 3, 10, 17, 20, 25, len(expected) - 1} {
+		limit := limit
+		t.Run(fmt.Sprintf("Limit=%d", limit), func(t *testing.T) {
+			w := &limitedWriter{limit: limit}
+			n, err := combined.WriteTo(w)
+			assert.Equal(t, errLimitReached, err)
+			assert.EqualValues(t, limit, n)
+			assert.Equal(t, expected[:limit], w.buf.String())
+		})
+	}
+
+	require.NoError(t, combined.Close())
+}
+
+var errLimitReached = errors.New("limit reached")
+
+// limitedWriter is an io.Writer that fails once a given number of bytes have
+// been written to it.
+type limitedWriter struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if remaining := w.limit - w.buf.Len(); len(p) > remaining {
+		w.buf.Write(p[:remaining])
+		return remaining, errLimitReached
+	}
+	return w.buf.Write(p)
+}
@@ -0,0 +1,230 @@
+package bytebuf
+
+import (
+	"io"
+	"sync"
+)
+
+// builderChunkSize is the size of the chunks that a Builder copies written
+// data into.
+const builderChunkSize = 16 * 1024
+
+var chunkPool = sync.Pool{
+	New: func() interface{} {
+		chunk := make([]byte, builderChunkSize)
+		return &chunk
+	},
+}
+
+// Builder is used to efficiently build a ByteBuf from multiple pieces of data.
+// Written data is copied into chunks of memory that are shared with the
+// ByteBuf returned from Freeze, and existing slices and ByteBufs can be
+// appended without copying. The zero value is ready to use.
+//
+// A Builder is not safe for concurrent use.
+type Builder struct {
+	// bufs are the completed pieces of the buffer being built.
+	bufs []ByteBuf
+
+	// slices are the in-memory slices following bufs that haven't yet
+	// been added to bufs.
+	slices [][]byte
+
+	// cur is the chunk currently being written into, and mark is the
+	// offset in it up to which data has been added to slices.
+	cur  []byte
+	mark int
+
+	// chunks holds the chunks allocated by this Builder; they're returned
+	// to the pool once the handle held by this Builder, and all handles
+	// held by the returned ByteBuf, have been closed.
+	chunks *builderChunks
+	handle
+
+	length int64
+}
+
+var (
+	_ io.Writer       = (*Builder)(nil)
+	_ io.ByteWriter   = (*Builder)(nil)
+	_ io.StringWriter = (*Builder)(nil)
+	_ io.ReaderFrom   = (*Builder)(nil)
+)
+
+type builderChunks struct {
+	chunks []*[]byte
+}
+
+func (c *builderChunks) release() error {
+	for _, chunk := range c.chunks {
+		chunkPool.Put(chunk)
+	}
+	c.chunks = nil
+	return nil
+}
+
+// Len returns the number of bytes written to the Builder.
+func (b *Builder) Len() int64 {
+	return b.length
+}
+
+// Write implements io.Writer; it never returns an error.
+func (b *Builder) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		copied := copy(b.available(), p)
+		b.cur = b.cur[:len(b.cur)+copied]
+		p = p[copied:]
+	}
+
+	b.length += int64(n)
+	return n, nil
+}
+
+// WriteByte implements io.ByteWriter; it never returns an error.
+func (b *Builder) WriteByte(c byte) error {
+	b.available()[0] = c
+	b.cur = b.cur[:len(b.cur)+1]
+	b.length++
+	return nil
+}
+
+// WriteString implements io.StringWriter; it never returns an error.
+func (b *Builder) WriteString(s string) (int, error) {
+	n := len(s)
+	for len(s) > 0 {
+		copied := copy(b.available(), s)
+		b.cur = b.cur[:len(b.cur)+copied]
+		s = s[copied:]
+	}
+
+	b.length += int64(n)
+	return n, nil
+}
+
+// ReadFrom implements io.ReaderFrom, reading from r directly into the
+// Builder's chunks until EOF.
+func (b *Builder) ReadFrom(r io.Reader) (n int64, err error) {
+	var currN int
+	for {
+		currN, err = r.Read(b.available())
+		if currN > 0 {
+			b.cur = b.cur[:len(b.cur)+currN]
+			b.length += int64(currN)
+			n += int64(currN)
+		}
+
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+	}
+}
+
+// AppendSlice appends the provided slice to the Builder without copying it.
+// The slice must not be modified while the Builder or the ByteBuf returned
+// from Freeze are in use.
+func (b *Builder) AppendSlice(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+
+	b.flushChunk()
+	b.slices = append(b.slices, p)
+	b.length += int64(len(p))
+}
+
+// AppendBuf appends the provided ByteBuf to the Builder without copying it.
+// The Builder takes ownership of buf, which will be closed when the ByteBuf
+// returned from Freeze is closed, or when the Builder is reset.
+func (b *Builder) AppendBuf(buf ByteBuf) {
+	// sliceBufs with no underlying resource can just have their slices
+	// appended directly.
+	if s, ok := buf.(*sliceBuf); ok && s.ref == nil {
+		for _, slice := range s.slices {
+			b.AppendSlice(slice)
+		}
+		return
+	}
+
+	b.flushChunk()
+	b.flushSlices()
+	b.bufs = append(b.bufs, buf)
+	b.length += buf.Length()
+}
+
+// Freeze returns an immutable ByteBuf containing all data written to the
+// Builder, which shares the Builder's memory. The Builder is reset and can be
+// reused afterwards.
+func (b *Builder) Freeze() ByteBuf {
+	b.flushChunk()
+	b.flushSlices()
+
+	var ret ByteBuf
+	for _, buf := range b.bufs {
+		if ret == nil {
+			ret = buf
+		} else {
+			ret = Append(ret, buf)
+		}
+	}
+	if ret == nil {
+		ret = Empty()
+	}
+
+	// Release our own reference to the chunks; the returned buffer now
+	// holds the remaining references.
+	b.close()
+	*b = Builder{}
+	return ret
+}
+
+// Reset discards all data in the Builder, closing any appended ByteBufs.
+func (b *Builder) Reset() {
+	for _, buf := range b.bufs {
+		buf.Close()
+	}
+	b.close()
+	*b = Builder{}
+}
+
+// available returns the unused space in the current chunk, allocating a new
+// chunk if there's none left.
+func (b *Builder) available() []byte {
+	if len(b.cur) == cap(b.cur) {
+		b.flushChunk()
+
+		if b.chunks == nil {
+			b.chunks = &builderChunks{}
+			b.ref = newRefCount(b.chunks.release)
+		}
+
+		chunk := chunkPool.Get().(*[]byte)
+		b.chunks.chunks = append(b.chunks.chunks, chunk)
+		b.cur = (*chunk)[:0]
+		b.mark = 0
+	}
+	return b.cur[len(b.cur):cap(b.cur)]
+}
+
+// flushChunk adds any data in the current chunk that hasn't yet been added to
+// slices.
+func (b *Builder) flushChunk() {
+	if len(b.cur) > b.mark {
+		b.slices = append(b.slices, b.cur[b.mark:len(b.cur):len(b.cur)])
+		b.mark = len(b.cur)
+	}
+}
+
+// flushSlices adds a sliceBuf containing the pending slices to bufs.
+func (b *Builder) flushSlices() {
+	if len(b.slices) == 0 {
+		return
+	}
+
+	buf := newSliceBuf(b.slices)
+	buf.handle = b.dup()
+	b.bufs = append(b.bufs, buf)
+	b.slices = nil
+}
@@ -0,0 +1,113 @@
+package bytebuf
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilder(t *testing.T) {
+	var b Builder
+
+	_, err := b.Write([]byte("foo"))
+	require.NoError(t, err)
+	require.NoError(t, b.WriteByte('b'))
+	_, err = b.WriteString("ar")
+	require.NoError(t, err)
+	b.AppendSlice([]byte("baz"))
+	_, err = b.ReadFrom(struct{ io.Reader }{strings.NewReader("asdf")})
+	require.NoError(t, err)
+
+	f := makeTempFile(t, "qwer")
+	fbuf, err := NewFromFile(f)
+	require.NoError(t, err)
+	b.AppendBuf(fbuf)
+	b.AppendBuf(NewFromString("zxcv"))
+
+	const expected = "foobarbazasdfqwerzxcv"
+	assert.EqualValues(t, len(expected), b.Len())
+
+	testByteBufImpl(t, b.Freeze(), expected)
+	assertFileClosed(t, f, true)
+
+	// The Builder should be reusable after being frozen.
+	assert.EqualValues(t, 0, b.Len())
+	_, err = b.WriteString("again")
+	require.NoError(t, err)
+	testByteBufImpl(t, b.Freeze(), "again")
+}
+
+func TestBuilderEmpty(t *testing.T) {
+	var b Builder
+	buf := b.Freeze()
+	assert.EqualValues(t, 0, buf.Length())
+	assert.NoError(t, buf.Close())
+}
+
+func TestBuilderLarge(t *testing.T) {
+	var (
+		b        Builder
+		expected strings.Builder
+	)
+
+	// Write enough data to span multiple chunks, interleaved with
+	// zero-copy slices.
+	for i := 0; expected.Len() < 3*builderChunkSize; i++ {
+		line := strings.Repeat("x", i%100) + "\n"
+		expected.WriteString(line)
+
+		if i%10 == 0 {
+			b.AppendSlice([]byte(line))
+		} else {
+			_, err := b.WriteString(line)
+			require.NoError(t, err)
+		}
+	}
+
+	buf := b.Freeze()
+	defer buf.Close()
+
+	data, err := ReadAll(buf)
+	require.NoError(t, err)
+	assert.Equal(t, expected.String(), string(data))
+}
+
+func TestBuilderSharesChunks(t *testing.T) {
+	var b Builder
+	_, err := b.WriteString("foobar")
+	require.NoError(t, err)
+
+	buf := b.Freeze()
+	sec := buf.Section(3, 3)
+	require.NoError(t, buf.Close())
+
+	// The section holds its own reference to the chunks, so they haven't
+	// been returned to the pool yet.
+	data, err := ReadAll(sec)
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(data))
+
+	// Reference-counted sliceBufs must not be coalesced with others.
+	combined := Append(sec, NewFromString("baz"))
+	assert.IsType(t, &combinedBuf{}, combined)
+	require.NoError(t, combined.Close())
+}
+
+func TestBuilderReset(t *testing.T) {
+	var b Builder
+	_, err := b.WriteString("foo")
+	require.NoError(t, err)
+
+	f := makeTempFile(t, "bar")
+	fbuf, err := NewFromFile(f)
+	require.NoError(t, err)
+	b.AppendBuf(fbuf)
+
+	b.Reset()
+	assertFileClosed(t, f, true)
+	assert.EqualValues(t, 0, b.Len())
+	assert.EqualValues(t, 0, b.Freeze().Length())
+}
@@ -18,8 +18,19 @@ type ByteBuf interface {
 	// Length returns the length of this ByteBuf.
 	Length() int64
 
-	// AsReader returns an io.Reader that reads the contents of this
-	// ByteBuf. The returned Reader will only be valid so long as this
-	// ByteBuf has not been closed.
-	AsReader() io.Reader
+	// AsReader returns a Reader that reads the contents of this ByteBuf,
+	// starting at the beginning. The returned Reader will only be valid so
+	// long as this ByteBuf has not been closed.
+	AsReader() *Reader
+
+	// Section returns a ByteBuf containing the n bytes of this ByteBuf
+	// starting at offset off. The offset and length are clamped to the
+	// bounds of this ByteBuf.
+	//
+	// The returned ByteBuf shares the underlying data with this ByteBuf and
+	// retains any optimized implementations (e.g. sendfile or writev) that
+	// it supports. It holds its own reference to any underlying resources,
+	// so it remains valid after this ByteBuf is closed and must itself be
+	// closed; see Retain.
+	Section(off, n int64) ByteBuf
 }
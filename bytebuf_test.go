@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -27,6 +28,65 @@ func testByteBufImpl(t *testing.T, impl ByteBuf, expected string) {
 		}
 	})
 
+	t.Run("Reader", func(t *testing.T) {
+		half := int64(len(expected) / 2)
+		seekTo := func(t *testing.T, off int64) *Reader {
+			r := impl.AsReader()
+			pos, err := r.Seek(off, io.SeekStart)
+			require.NoError(t, err)
+			require.Equal(t, off, pos)
+			require.EqualValues(t, int64(len(expected))-off, r.Len())
+			return r
+		}
+
+		t.Run("ReadByte", func(t *testing.T) {
+			r := seekTo(t, half)
+			var got []byte
+			for {
+				c, err := r.ReadByte()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				got = append(got, c)
+			}
+			assert.Equal(t, expected[half:], string(got))
+
+			if len(expected) > 0 {
+				require.NoError(t, r.UnreadByte())
+				c, err := r.ReadByte()
+				require.NoError(t, err)
+				assert.Equal(t, expected[len(expected)-1], c)
+			}
+		})
+
+		t.Run("Read", func(t *testing.T) {
+			r := seekTo(t, half)
+			data, err := ioutil.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, expected[half:], string(data))
+			assert.EqualValues(t, 0, r.Len())
+			assert.EqualValues(t, len(expected), r.Size())
+		})
+
+		t.Run("WriteToFile", func(t *testing.T) {
+			f := makeTempFile(t, "")
+			defer f.Close()
+
+			n, err := io.Copy(f, seekTo(t, half))
+			require.NoError(t, err)
+			require.EqualValues(t, int64(len(expected))-half, n)
+
+			data, err := ioutil.ReadAll(io.NewSectionReader(f, 0, n))
+			require.NoError(t, err)
+			assert.Equal(t, expected[half:], string(data))
+		})
+
+		t.Run("WriteToConn", func(t *testing.T) {
+			assertCopyViaConn(t, seekTo(t, half), expected[half:])
+		})
+	})
+
 	t.Run("ReadAt", func(t *testing.T) {
 		assertReadAt := func(t *testing.T, offset, length int, data string) {
 			buf := make([]byte, length)
@@ -84,14 +144,80 @@ func testByteBufImpl(t *testing.T, impl ByteBuf, expected string) {
 		t.Run("WriteToConn", func(t *testing.T) {
 			assertCopyViaConn(t, impl, expected)
 		})
+
+		t.Run("WriteToUnixConn", func(t *testing.T) {
+			assertCopyViaUnixConn(t, impl, expected)
+		})
+
+		t.Run("WriteToPipe", func(t *testing.T) {
+			assertCopyViaPipe(t, impl, expected)
+		})
 	})
 }
 
+// byteBufImpl is a buffer created with one of the ByteBuf implementations.
+type byteBufImpl struct {
+	Name string
+	Buf  ByteBuf
+}
+
+// byteBufImpls returns a buffer containing data for each of the main ByteBuf
+// implementations, so that the same test can be run against all of them. The
+// buffers are split at different offsets where possible: the file buffer is
+// a section of a larger file, and the slice and combined buffers are made up
+// of several parts. They're closed when the test finishes.
+func byteBufImpls(t *testing.T, data string) []byteBufImpl {
+	a, b := len(data)/3, 2*len(data)/3
+
+	file, err := NewFromFile(makeTempFile(t, "xx"+data+"yy"))
+	require.NoError(t, err)
+	defer file.Close()
+
+	mmap, err := NewFromFileMmap(makeTempFile(t, data), MmapNormal)
+	require.NoError(t, err)
+
+	combinedFile, err := NewFromFile(makeTempFile(t, data[a:b]))
+	require.NoError(t, err)
+
+	impls := []byteBufImpl{
+		{"Slice", NewFromSlices([]byte(data[:a]), []byte(data[a:b]), []byte(data[b:]))},
+		{"File", file.Section(2, int64(len(data)))},
+		{"Mmap", mmap},
+		{"BytesReader", NewFromBytesReader(bytes.NewReader([]byte(data)))},
+		{"Combined", newCombinedBuf([]ByteBuf{
+			NewFromString(data[:a]),
+			combinedFile,
+			NewFromString(data[b:]),
+		})},
+	}
+	t.Cleanup(func() {
+		for _, impl := range impls {
+			impl.Buf.Close()
+		}
+	})
+	return impls
+}
+
 // assertCopyViaConn will copy the given buffer to a net.Conn and assert that
 // the data matches the expected value.
 func assertCopyViaConn(t *testing.T, buf io.WriterTo, expected string) {
 	l, err := net.Listen("tcp", "localhost:0")
 	require.NoError(t, err)
+	assertCopyViaListener(t, l, buf, expected)
+}
+
+// assertCopyViaUnixConn is like assertCopyViaConn, but uses a Unix socket.
+func assertCopyViaUnixConn(t *testing.T, buf io.WriterTo, expected string) {
+	l, err := net.Listen("unix", filepath.Join(t.TempDir(), "sock"))
+	if err != nil {
+		t.Skipf("unix sockets not supported: %v", err)
+	}
+	assertCopyViaListener(t, l, buf, expected)
+}
+
+// assertCopyViaListener will copy the given buffer to a connection to the
+// provided listener and assert that the data matches the expected value.
+func assertCopyViaListener(t *testing.T, l net.Listener, buf io.WriterTo, expected string) {
 	defer l.Close()
 
 	var (
@@ -135,6 +261,36 @@ func assertCopyViaConn(t *testing.T, buf io.WriterTo, expected string) {
 	assert.Equal(t, expected, connBuf.String())
 }
 
+// assertCopyViaPipe will copy the given buffer to a pipe and assert that the
+// data matches the expected value.
+func assertCopyViaPipe(t *testing.T, buf io.WriterTo, expected string) {
+	pr, pw, err := os.Pipe()
+	require.NoError(t, err)
+	defer pr.Close()
+	defer pw.Close()
+
+	var (
+		pipeBuf  bytes.Buffer
+		readDone = make(chan struct{})
+	)
+	go func() {
+		defer close(readDone)
+		_, err := io.Copy(&pipeBuf, pr)
+		assert.NoError(t, err)
+	}()
+
+	n, err := buf.WriteTo(pw)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.EqualValues(t, len(expected), n)
+
+	// Close the write end to signal EOF
+	pw.Close()
+	<-readDone
+	assert.Equal(t, expected, pipeBuf.String())
+}
+
 // makeTempFile creates a temporary file with the provided data in the tests's
 // TempDir.
 func makeTempFile(t *testing.T, expected string) *os.File {
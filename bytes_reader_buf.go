@@ -8,6 +8,8 @@ import (
 // bytesReaderBuf is a ByteBuf that's backed by a bytes.Reader
 type bytesReaderBuf struct {
 	r *bytes.Reader
+
+	digestCache
 }
 
 var _ ByteBuf = (*bytesReaderBuf)(nil)
@@ -24,16 +26,16 @@ func (b *bytesReaderBuf) Length() int64 {
 }
 
 // AsReader implements ByteBuf
-func (b *bytesReaderBuf) AsReader() io.Reader {
-	return io.NewSectionReader(b.r, 0, b.Length())
+func (b *bytesReaderBuf) AsReader() *Reader {
+	return NewReader(b)
 }
 
 // WriteTo implements io.WriterTo
 func (b *bytesReaderBuf) WriteTo(w io.Writer) (n int64, err error) {
 	// NOTE: the underlying bytes.Reader has a WriteTo implementation that
-	// modifies the buffer, so we can't use it. Instead, use AsReader() -
-	// and we should see if we can optimize this.
-	return io.Copy(w, b.AsReader())
+	// modifies the buffer, so we can't use it. Instead, use a
+	// SectionReader - and we should see if we can optimize this.
+	return io.Copy(w, io.NewSectionReader(b.r, 0, b.Length()))
 }
 
 // ReadAt implements io.ReaderAt
@@ -41,6 +43,13 @@ func (b *bytesReaderBuf) ReadAt(p []byte, off int64) (int, error) {
 	return b.r.ReadAt(p, off)
 }
 
+// Section implements ByteBuf
+func (b *bytesReaderBuf) Section(off, n int64) ByteBuf {
+	// Sections use their own handle to the bytes.Reader, so that they're
+	// unaffected by this buffer being closed.
+	return newSection(&bytesReaderBuf{r: b.r}, off, n)
+}
+
 func (b *bytesReaderBuf) Close() error {
 	b.r = nil
 	return nil
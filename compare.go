@@ -0,0 +1,126 @@
+package bytebuf
+
+import (
+	"bytes"
+	"errors"
+)
+
+// errStopWalk is returned from walkSegments callbacks to stop walking early.
+var errStopWalk = errors.New("bytebuf: stop walk")
+
+// Equal returns whether a and b contain the same data.
+//
+// Buffers of different lengths are never equal, and digests cached on both
+// buffers (see DigestOptions) are used to avoid reading the data where
+// possible. Otherwise, the data is compared segment-by-segment, without
+// reading either buffer fully into memory.
+func Equal(a, b ByteBuf) (bool, error) {
+	if a.Length() != b.Length() {
+		return false, nil
+	}
+	if equal, ok := compareDigests(a, b); ok {
+		return equal, nil
+	}
+
+	cmp, err := compareData(a, b)
+	if err != nil {
+		return false, err
+	}
+	return cmp == 0, nil
+}
+
+// Compare returns an integer comparing the data in two buffers
+// lexicographically, in the same manner as bytes.Compare. The result will be 0
+// if a == b, -1 if a < b, and +1 if a > b.
+//
+// Like Equal, this uses cached digests where possible, and otherwise compares
+// the data segment-by-segment.
+func Compare(a, b ByteBuf) (int, error) {
+	if a.Length() == b.Length() {
+		if equal, ok := compareDigests(a, b); ok && equal {
+			return 0, nil
+		}
+	}
+	return compareData(a, b)
+}
+
+// compareDigests compares the cached digests of two buffers; ok is false if
+// this doesn't determine whether the buffers are equal.
+func compareDigests(a, b ByteBuf) (equal, ok bool) {
+	ca, cb := digestCacheFor(a), digestCacheFor(b)
+	if ca == nil || cb == nil {
+		return false, false
+	}
+
+	for _, algo := range []DigestAlgorithm{SHA256, SHA512, CRC32C, CRC32IEEE} {
+		sa, ok := ca.get(algo)
+		if !ok {
+			continue
+		}
+		sb, ok := cb.get(algo)
+		if !ok {
+			continue
+		}
+
+		// Any mismatched digest means that the data differs, but only
+		// a matching cryptographic hash means that it's the same.
+		if !bytes.Equal(sa, sb) {
+			return false, true
+		}
+		if algo.crc32Table() == nil {
+			return true, true
+		}
+	}
+	return false, false
+}
+
+// compareData compares the data in two buffers by walking the segments of one
+// and comparing each of them with the corresponding range of the other.
+func compareData(a, b ByteBuf) (int, error) {
+	// Walk the buffer that's not in memory (if any), so that it's read in
+	// large chunks, and compare each chunk against the other buffer; if
+	// the other buffer is in memory, this doesn't copy its data.
+	outer, inner, sign := a, b, 1
+	if inMemory(a) && !inMemory(b) {
+		outer, inner, sign = b, a, -1
+	}
+
+	length := outer.Length()
+	if inner.Length() < length {
+		length = inner.Length()
+	}
+
+	var (
+		off    int64
+		cmp    int
+		walker segmentWalker
+	)
+	err := walkSegments(outer, 0, length, func(p []byte) error {
+		n := int64(len(p))
+		err := walker.walk(inner, off, n, func(q []byte) error {
+			cmp = bytes.Compare(p[:len(q)], q)
+			if cmp != 0 {
+				return errStopWalk
+			}
+			p = p[len(q):]
+			return nil
+		})
+		off += n
+		return err
+	})
+	if err == errStopWalk {
+		return sign * cmp, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	// The common prefix is the same, so the shorter buffer is smaller.
+	switch {
+	case a.Length() < b.Length():
+		return -1, nil
+	case a.Length() > b.Length():
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
@@ -0,0 +1,92 @@
+package bytebuf
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	cases := []struct {
+		A, B string
+	}{
+		{"", ""},
+		{"", "a"},
+		{"foobar", "foobar"},
+		{"foobar", "foobaz"},
+		{"foobar", "goobar"},
+		{"foo", "foobar"},
+		{"foobarbaz", "foobar"},
+		{"abcdefghijklmnop", "abcdefghijklmnoq"},
+	}
+
+	for _, tc := range cases {
+		for _, swap := range []bool{false, true} {
+			as, bs := tc.A, tc.B
+			if swap {
+				as, bs = bs, as
+			}
+
+			implsA, implsB := byteBufImpls(t, as), byteBufImpls(t, bs)
+			for _, ia := range implsA {
+				for _, ib := range implsB {
+					a, b := ia.Buf, ib.Buf
+					desc := fmt.Sprintf("%s(%q), %s(%q)", ia.Name, as, ib.Name, bs)
+
+					cmp, err := Compare(a, b)
+					require.NoError(t, err, desc)
+					assert.Equal(t, bytes.Compare([]byte(as), []byte(bs)), cmp, "Compare(%s)", desc)
+
+					equal, err := Equal(a, b)
+					require.NoError(t, err, desc)
+					assert.Equal(t, as == bs, equal, "Equal(%s)", desc)
+				}
+			}
+		}
+	}
+}
+
+func TestEqualCachedDigests(t *testing.T) {
+	a := NewFromString("foobar")
+	defer a.Close()
+	b := NewFromString("foobaz")
+	defer b.Close()
+
+	// Plant matching digests, to verify that they're used instead of
+	// comparing the data.
+	digestCacheFor(a).put(SHA256, []byte("same"))
+	digestCacheFor(b).put(SHA256, []byte("same"))
+
+	equal, err := Equal(a, b)
+	require.NoError(t, err)
+	assert.True(t, equal)
+
+	cmp, err := Compare(a, b)
+	require.NoError(t, err)
+	assert.Equal(t, 0, cmp)
+}
+
+func TestEqualCachedCRC(t *testing.T) {
+	a := NewFromString("foobar")
+	defer a.Close()
+	b := NewFromString("foobar")
+	defer b.Close()
+
+	// A matching CRC isn't enough to determine that the buffers are
+	// equal, but a mismatched one shows that they differ.
+	digestCacheFor(a).put(CRC32C, []byte("same"))
+	digestCacheFor(b).put(CRC32C, []byte("same"))
+
+	equal, err := Equal(a, b)
+	require.NoError(t, err)
+	assert.True(t, equal)
+
+	digestCacheFor(b).put(CRC32C, []byte("different"))
+
+	equal, err = Equal(a, b)
+	require.NoError(t, err)
+	assert.False(t, equal)
+}
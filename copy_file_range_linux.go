@@ -18,7 +18,20 @@ var copyFileRangeSupported uint32 = 1
 // This is a variable so we can override it in testing.
 var maxCopyFileRangeSize int = 100 * 1024 * 1024
 
-func maybeCopyFileRange(dst, src syscall.Conn, remain int64) (int64, bool, error) {
+func maybeCopyFileRange(dst, src syscall.Conn, srcOffset, remain int64) (int64, bool, error) {
+	// Use (and update) the destination file's offset.
+	return copyFileRangeConns(dst, src, nil, srcOffset, remain)
+}
+
+// maybeCopyFileRangeAt is like maybeCopyFileRange, but writes at the given
+// offset in the destination file, without using or updating the file's
+// offset; it's safe to call concurrently for different ranges of the same
+// file.
+func maybeCopyFileRangeAt(dst, src syscall.Conn, dstOffset, srcOffset, remain int64) (int64, bool, error) {
+	return copyFileRangeConns(dst, src, &dstOffset, srcOffset, remain)
+}
+
+func copyFileRangeConns(dst, src syscall.Conn, dstOffset *int64, srcOffset, remain int64) (int64, bool, error) {
 	srcConn, err := src.SyscallConn()
 	if err != nil {
 		return 0, false, nil
@@ -29,10 +42,7 @@ func maybeCopyFileRange(dst, src syscall.Conn, remain int64) (int64, bool, error
 		return 0, false, nil
 	}
 
-	var (
-		written   int64
-		srcOffset int64
-	)
+	var written int64
 
 	for remain > 0 {
 		n := maxCopyFileRangeSize
@@ -49,7 +59,7 @@ func maybeCopyFileRange(dst, src syscall.Conn, remain int64) (int64, bool, error
 				currWritten, werr = copyFileRange(
 					int(dstfd),
 					int(srcfd),
-					nil, // use destination file offset
+					dstOffset,
 					&srcOffset,
 					n,
 				)
@@ -6,6 +6,10 @@ import (
 	"syscall"
 )
 
-func maybeCopyFileRange(dst, src syscall.Conn, l int64) (n int64, handled bool, err error) {
+func maybeCopyFileRange(dst, src syscall.Conn, off, l int64) (n int64, handled bool, err error) {
+	return 0, false, nil
+}
+
+func maybeCopyFileRangeAt(dst, src syscall.Conn, dstOff, srcOff, l int64) (n int64, handled bool, err error) {
 	return 0, false, nil
 }
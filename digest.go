@@ -0,0 +1,377 @@
+package bytebuf
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"runtime"
+	"sync"
+)
+
+// DigestAlgorithm identifies a hash algorithm that can be used with Digest.
+type DigestAlgorithm int
+
+const (
+	// SHA256 is the SHA-256 hash algorithm.
+	SHA256 DigestAlgorithm = iota + 1
+
+	// SHA512 is the SHA-512 hash algorithm.
+	SHA512
+
+	// CRC32IEEE is the CRC-32 checksum with the IEEE polynomial. The
+	// digest is the checksum in big-endian byte order.
+	CRC32IEEE
+
+	// CRC32C is the CRC-32 checksum with the Castagnoli polynomial. The
+	// digest is the checksum in big-endian byte order.
+	CRC32C
+)
+
+var errUnknownAlgorithm = errors.New("bytebuf: unknown digest algorithm")
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// String returns the name of the algorithm.
+func (a DigestAlgorithm) String() string {
+	switch a {
+	case SHA256:
+		return "sha256"
+	case SHA512:
+		return "sha512"
+	case CRC32IEEE:
+		return "crc32"
+	case CRC32C:
+		return "crc32c"
+	default:
+		return "unknown"
+	}
+}
+
+// crc32Table returns the table for a CRC-32 algorithm, or nil if this isn't
+// one; the results of CRC-32 algorithms can be combined, which lets us hash
+// parts of a buffer in parallel.
+func (a DigestAlgorithm) crc32Table() *crc32.Table {
+	switch a {
+	case CRC32IEEE:
+		return crc32.IEEETable
+	case CRC32C:
+		return crc32cTable
+	default:
+		return nil
+	}
+}
+
+func (a DigestAlgorithm) newHash() (hash.Hash, error) {
+	switch a {
+	case SHA256:
+		return sha256.New(), nil
+	case SHA512:
+		return sha512.New(), nil
+	case CRC32IEEE, CRC32C:
+		return crc32.New(a.crc32Table()), nil
+	default:
+		return nil, errUnknownAlgorithm
+	}
+}
+
+// DigestOptions controls the behaviour of DigestWithOptions.
+type DigestOptions struct {
+	// Cache controls whether computed digests are stored on the buffer, so
+	// that future calls for the same buffer and algorithm don't need to
+	// read the data again. Cached digests are used regardless of this
+	// option. Note that this assumes that the data is immutable; if a file
+	// backing a buffer is modified, its cached digests will be stale.
+	Cache bool
+
+	// Concurrency is the maximum number of goroutines that will be used to
+	// hash different parts of the buffer in parallel, for algorithms where
+	// that's possible (i.e. CRC-32). If zero, runtime.GOMAXPROCS(0) is
+	// used.
+	Concurrency int
+}
+
+// minParallelDigestSize is the minimum amount of data that each goroutine
+// hashes when computing a digest in parallel.
+const minParallelDigestSize = 4 * 1024 * 1024
+
+// Digest computes the digest of the data in b with the given algorithm. This
+// is equivalent to calling DigestWithOptions with the zero DigestOptions.
+func Digest(b ByteBuf, algo DigestAlgorithm) ([]byte, error) {
+	sums, err := DigestWithOptions(b, DigestOptions{}, algo)
+	if err != nil {
+		return nil, err
+	}
+	return sums[0], nil
+}
+
+// DigestWithOptions computes the digests of the data in b with all of the
+// given algorithms, returning them in the same order. The data is only read
+// once; in-memory data is hashed without copying, and file-backed data is
+// read in large chunks.
+func DigestWithOptions(b ByteBuf, opts DigestOptions, algos ...DigestAlgorithm) ([][]byte, error) {
+	sums := make([][]byte, len(algos))
+	cache := digestCacheFor(b)
+
+	// Determine which digests we still need to compute.
+	var missing []int
+	for i, algo := range algos {
+		if sum, ok := cache.get(algo); ok {
+			sums[i] = sum
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return sums, nil
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+
+	// If all the remaining algorithms are CRC-32, then we can compute them
+	// in parallel; otherwise, compute them all in a single pass.
+	parallel := concurrency > 1 && b.Length() >= 2*minParallelDigestSize
+	for _, i := range missing {
+		if algos[i].crc32Table() == nil {
+			parallel = false
+		}
+	}
+
+	var err error
+	if parallel {
+		err = digestParallel(b, concurrency, algos, missing, sums)
+	} else {
+		err = digestSequential(b, algos, missing, sums)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Cache {
+		for _, i := range missing {
+			cache.put(algos[i], sums[i])
+		}
+	}
+	return sums, nil
+}
+
+// digestSequential computes the digests for the given indexes in a single
+// pass over the data.
+func digestSequential(b ByteBuf, algos []DigestAlgorithm, missing []int, sums [][]byte) error {
+	hashes := make([]hash.Hash, len(missing))
+	for j, i := range missing {
+		h, err := algos[i].newHash()
+		if err != nil {
+			return err
+		}
+		hashes[j] = h
+	}
+
+	err := walkSegments(b, 0, b.Length(), func(p []byte) error {
+		for _, h := range hashes {
+			h.Write(p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for j, i := range missing {
+		sums[i] = hashes[j].Sum(nil)
+	}
+	return nil
+}
+
+// digestParallel computes the CRC-32 digests for the given indexes by splitting
+// the data into parts, hashing them concurrently, and combining the results.
+func digestParallel(b ByteBuf, concurrency int, algos []DigestAlgorithm, missing []int, sums [][]byte) error {
+	length := b.Length()
+	partSize := (length + int64(concurrency) - 1) / int64(concurrency)
+	if partSize < minParallelDigestSize {
+		partSize = minParallelDigestSize
+	}
+	numParts := int((length + partSize - 1) / partSize)
+
+	var (
+		wg   sync.WaitGroup
+		crcs = make([][]uint32, numParts)
+		errs = make([]error, numParts)
+		lens = make([]int64, numParts)
+	)
+	for part := 0; part < numParts; part++ {
+		off := int64(part) * partSize
+		n := partSize
+		if off+n > length {
+			n = length - off
+		}
+		lens[part] = n
+
+		wg.Add(1)
+		go func(part int, off, n int64) {
+			defer wg.Done()
+
+			curr := make([]uint32, len(missing))
+			errs[part] = walkSegments(b, off, n, func(p []byte) error {
+				for j, i := range missing {
+					curr[j] = crc32.Update(curr[j], algos[i].crc32Table(), p)
+				}
+				return nil
+			})
+			crcs[part] = curr
+		}(part, off, n)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	for j, i := range missing {
+		poly := crc32Poly(algos[i])
+
+		crc := crcs[0][j]
+		for part := 1; part < numParts; part++ {
+			crc = crc32Combine(poly, crc, crcs[part][j], lens[part])
+		}
+
+		sum := make([]byte, 4)
+		binary.BigEndian.PutUint32(sum, crc)
+		sums[i] = sum
+	}
+	return nil
+}
+
+// crc32Poly returns the reversed polynomial for a CRC-32 algorithm.
+func crc32Poly(algo DigestAlgorithm) uint32 {
+	if algo == CRC32C {
+		return crc32.Castagnoli
+	}
+	return crc32.IEEE
+}
+
+// crc32Combine returns the CRC-32 of the concatenation of two pieces of data,
+// given the CRC-32 of each piece and the length of the second. This is a port
+// of crc32_combine from zlib, which works by applying a matrix operator that
+// appends len2 zero bytes to crc1.
+func crc32Combine(poly, crc1, crc2 uint32, len2 int64) uint32 {
+	if len2 <= 0 {
+		return crc1
+	}
+
+	// Operator for one zero bit is in odd; the first row is the
+	// polynomial, and subsequent rows shift.
+	var even, odd [32]uint32
+	odd[0] = poly
+	row := uint32(1)
+	for n := 1; n < 32; n++ {
+		odd[n] = row
+		row <<= 1
+	}
+
+	// Two zero bits, then four zero bits.
+	gf2MatrixSquare(&even, &odd)
+	gf2MatrixSquare(&odd, &even)
+
+	// Apply len2 zero bytes to crc1; the first square puts the operator
+	// for one zero byte (eight zero bits) in even.
+	for {
+		gf2MatrixSquare(&even, &odd)
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(&even, crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+
+		gf2MatrixSquare(&odd, &even)
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(&odd, crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+	}
+
+	return crc1 ^ crc2
+}
+
+func gf2MatrixTimes(mat *[32]uint32, vec uint32) uint32 {
+	var sum uint32
+	for i := 0; vec != 0; i++ {
+		if vec&1 != 0 {
+			sum ^= mat[i]
+		}
+		vec >>= 1
+	}
+	return sum
+}
+
+func gf2MatrixSquare(square, mat *[32]uint32) {
+	for n := 0; n < 32; n++ {
+		square[n] = gf2MatrixTimes(mat, mat[n])
+	}
+}
+
+// digestCache stores the digests that have been computed for a buffer; it's
+// embedded in each ByteBuf implementation in this package.
+type digestCache struct {
+	mu   sync.Mutex
+	sums map[DigestAlgorithm][]byte
+}
+
+// digestCacher is implemented by ByteBufs that embed a digestCache.
+type digestCacher interface {
+	cachedDigests() *digestCache
+}
+
+func (c *digestCache) cachedDigests() *digestCache {
+	return c
+}
+
+// digestCacheFor returns the digest cache for the given buffer, or nil if it
+// doesn't have one.
+func digestCacheFor(b ByteBuf) *digestCache {
+	if c, ok := b.(digestCacher); ok {
+		return c.cachedDigests()
+	}
+	return nil
+}
+
+func (c *digestCache) get(algo DigestAlgorithm) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sum, ok := c.sums[algo]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), sum...), true
+}
+
+func (c *digestCache) put(algo DigestAlgorithm, sum []byte) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.sums == nil {
+		c.sums = make(map[DigestAlgorithm][]byte)
+	}
+	c.sums[algo] = append([]byte(nil), sum...)
+}
@@ -0,0 +1,141 @@
+package bytebuf
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"hash/crc32"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func expectedDigest(algo DigestAlgorithm, data []byte) []byte {
+	switch algo {
+	case SHA256:
+		sum := sha256.Sum256(data)
+		return sum[:]
+	case SHA512:
+		sum := sha512.Sum512(data)
+		return sum[:]
+	default:
+		sum := make([]byte, 4)
+		binary.BigEndian.PutUint32(sum, crc32.Checksum(data, algo.crc32Table()))
+		return sum
+	}
+}
+
+var allDigestAlgorithms = []DigestAlgorithm{SHA256, SHA512, CRC32IEEE, CRC32C}
+
+func TestDigest(t *testing.T) {
+	const expected = `foobarbazasdfqwer`
+
+	impls := append([]byteBufImpl{{"Empty", Empty()}}, byteBufImpls(t, expected)...)
+	for _, impl := range impls {
+		buf := impl.Buf
+		t.Run(impl.Name, func(t *testing.T) {
+			data := []byte(expected)
+			if buf.Length() == 0 {
+				data = nil
+			}
+
+			for _, algo := range allDigestAlgorithms {
+				sum, err := Digest(buf, algo)
+				require.NoError(t, err, algo)
+				assert.Equal(t, expectedDigest(algo, data), sum, algo)
+			}
+
+			// All at once, in a single pass.
+			sums, err := DigestWithOptions(buf, DigestOptions{}, allDigestAlgorithms...)
+			require.NoError(t, err)
+			for i, algo := range allDigestAlgorithms {
+				assert.Equal(t, expectedDigest(algo, data), sums[i], algo)
+			}
+		})
+	}
+}
+
+func TestDigestParallel(t *testing.T) {
+	data := make([]byte, 3*minParallelDigestSize+12345)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	// Mix in-memory and file-backed data, with a boundary that isn't
+	// aligned with any of the parts.
+	split := minParallelDigestSize + 100
+	file, err := NewFromFile(makeTempFile(t, string(data[split:])))
+	require.NoError(t, err)
+	buf := Append(NewFromSlice(data[:split]), file)
+	defer buf.Close()
+
+	algos := []DigestAlgorithm{CRC32IEEE, CRC32C}
+	for _, concurrency := range []int{1, 2, 3, 8} {
+		sums, err := DigestWithOptions(buf, DigestOptions{Concurrency: concurrency}, algos...)
+		require.NoError(t, err)
+		for i, algo := range algos {
+			assert.Equal(t, expectedDigest(algo, data), sums[i], "%s with concurrency %d", algo, concurrency)
+		}
+	}
+}
+
+func TestCRC32Combine(t *testing.T) {
+	data := make([]byte, 10000)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	for _, algo := range []DigestAlgorithm{CRC32IEEE, CRC32C} {
+		table := algo.crc32Table()
+		for _, split := range []int{0, 1, 7, 4096, 9999, 10000} {
+			crc1 := crc32.Checksum(data[:split], table)
+			crc2 := crc32.Checksum(data[split:], table)
+
+			combined := crc32Combine(crc32Poly(algo), crc1, crc2, int64(len(data)-split))
+			assert.Equal(t, crc32.Checksum(data, table), combined, "%s split at %d", algo, split)
+		}
+	}
+}
+
+func TestDigestCache(t *testing.T) {
+	buf := NewFromString("foobar")
+	defer buf.Close()
+
+	// Without caching, nothing is stored.
+	_, err := DigestWithOptions(buf, DigestOptions{}, SHA256)
+	require.NoError(t, err)
+	_, ok := digestCacheFor(buf).get(SHA256)
+	assert.False(t, ok)
+
+	sums, err := DigestWithOptions(buf, DigestOptions{Cache: true}, SHA256)
+	require.NoError(t, err)
+	cached, ok := digestCacheFor(buf).get(SHA256)
+	require.True(t, ok)
+	assert.Equal(t, sums[0], cached)
+
+	// Plant a fake value in the cache, to verify that it's used instead of
+	// reading the data again.
+	fake := []byte("not a real digest")
+	digestCacheFor(buf).put(SHA256, fake)
+
+	sum, err := Digest(buf, SHA256)
+	require.NoError(t, err)
+	assert.Equal(t, fake, sum)
+
+	// Modifying the returned digest doesn't affect the cache.
+	sum[0] = 'X'
+	sum, err = Digest(buf, SHA256)
+	require.NoError(t, err)
+	assert.Equal(t, fake, sum)
+
+	// Other algorithms are still computed.
+	sum, err = Digest(buf, CRC32C)
+	require.NoError(t, err)
+	assert.Equal(t, expectedDigest(CRC32C, []byte("foobar")), sum)
+}
+
+func TestDigestUnknownAlgorithm(t *testing.T) {
+	buf := NewFromString("foobar")
+	defer buf.Close()
+
+	_, err := Digest(buf, DigestAlgorithm(0))
+	assert.Equal(t, errUnknownAlgorithm, err)
+}
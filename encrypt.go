@@ -0,0 +1,216 @@
+package bytebuf
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// ErrTampered is returned when reading from an encrypted buffer (see
+// ReaderOptions.Encrypt) if the encrypted data has been modified.
+var ErrTampered = errors.New("bytebuf: encrypted data has been tampered with")
+
+const (
+	// encryptedChunkSize is the amount of plaintext in each encrypted
+	// chunk; each chunk is sealed separately, so that it can be decrypted
+	// independently.
+	encryptedChunkSize = 64 * 1024
+
+	// encryptedChunkOverhead is the size of the authentication tag that's
+	// appended to each chunk.
+	encryptedChunkOverhead = 16
+)
+
+var encryptedChunkPool = sync.Pool{
+	New: func() interface{} {
+		chunk := make([]byte, encryptedChunkSize+encryptedChunkOverhead)
+		return &chunk
+	},
+}
+
+// encryptedBuf is a ByteBuf that's backed by data encrypted with AES-GCM, in
+// chunks of encryptedChunkSize bytes. Each chunk is sealed with a nonce
+// containing its index, so chunks can't be reordered.
+type encryptedBuf struct {
+	src    ByteBuf
+	aead   cipher.AEAD
+	length int64
+
+	digestCache
+}
+
+var _ ByteBuf = (*encryptedBuf)(nil)
+
+// newEphemeralAEAD creates an AES-GCM cipher with a new random key, which is
+// never stored anywhere other than the returned cipher.
+func newEphemeralAEAD() (cipher.AEAD, error) {
+	var key [32]byte
+	if _, err := io.ReadFull(rand.Reader, key[:]); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce returns the nonce for the chunk with the given index.
+func chunkNonce(idx int64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], uint64(idx))
+	return nonce
+}
+
+// spillEncrypted is like spill, but encrypts the data with a new key, and
+// returns an encryptedBuf backed by the file.
+func spillEncrypted(f *os.File, path string, slices [][]byte, r io.Reader) (*encryptedBuf, error) {
+	aead, err := newEphemeralAEAD()
+	if err != nil {
+		return nil, err
+	}
+
+	chunk := encryptedChunkPool.Get().(*[]byte)
+	defer encryptedChunkPool.Put(chunk)
+
+	r = io.MultiReader(NewFromSlices(slices...).AsReader(), r)
+
+	var length int64
+	for idx := int64(0); ; idx++ {
+		n, err := io.ReadFull(r, (*chunk)[:encryptedChunkSize])
+		if n > 0 {
+			sealed := aead.Seal((*chunk)[:0], chunkNonce(idx), (*chunk)[:n], nil)
+			if _, err := f.Write(sealed); err != nil {
+				return nil, err
+			}
+			length += int64(n)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	fb, err := newFileBuf(f)
+	if err != nil {
+		return nil, err
+	}
+	fb.path = path
+	return &encryptedBuf{src: fb, aead: aead, length: length}, nil
+}
+
+// Length implements ByteBuf
+func (b *encryptedBuf) Length() int64 {
+	return b.length
+}
+
+// AsReader implements ByteBuf
+func (b *encryptedBuf) AsReader() *Reader {
+	return NewReader(b)
+}
+
+// WriteTo implements io.WriterTo
+func (b *encryptedBuf) WriteTo(w io.Writer) (n int64, err error) {
+	chunk := encryptedChunkPool.Get().(*[]byte)
+	defer encryptedChunkPool.Put(chunk)
+
+	for idx := int64(0); idx*encryptedChunkSize < b.length; idx++ {
+		plain, err := b.readChunk(*chunk, idx)
+		if err != nil {
+			return n, err
+		}
+
+		currN, err := w.Write(plain)
+		n += int64(currN)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// readChunk reads and decrypts the chunk with the given index, using buf as
+// storage for the ciphertext and returned plaintext.
+func (b *encryptedBuf) readChunk(buf []byte, idx int64) ([]byte, error) {
+	size := b.length - idx*encryptedChunkSize
+	if size > encryptedChunkSize {
+		size = encryptedChunkSize
+	}
+
+	ciphertext := buf[:size+encryptedChunkOverhead]
+	n, err := b.src.ReadAt(ciphertext, idx*(encryptedChunkSize+encryptedChunkOverhead))
+	if n < len(ciphertext) {
+		// If the file was truncated, the data has been modified.
+		if err == nil || err == io.EOF {
+			err = ErrTampered
+		}
+		return nil, err
+	}
+
+	plain, err := b.aead.Open(ciphertext[:0], chunkNonce(idx), ciphertext, nil)
+	if err != nil {
+		return nil, ErrTampered
+	}
+	return plain, nil
+}
+
+// ReadAt implements io.ReaderAt
+func (b *encryptedBuf) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+	if off >= b.length {
+		return 0, io.EOF
+	}
+
+	want := p
+	if max := b.length - off; int64(len(want)) > max {
+		want = want[:max]
+	}
+
+	chunk := encryptedChunkPool.Get().(*[]byte)
+	defer encryptedChunkPool.Put(chunk)
+
+	// Decrypt each chunk that overlaps with the requested range.
+	copied := 0
+	for len(want) > 0 {
+		plain, err := b.readChunk(*chunk, off/encryptedChunkSize)
+		if err != nil {
+			return copied, err
+		}
+
+		n := copy(want, plain[off%encryptedChunkSize:])
+		copied += n
+		off += int64(n)
+		want = want[n:]
+	}
+
+	if copied < len(p) {
+		return copied, io.EOF
+	}
+	return copied, nil
+}
+
+// Section implements ByteBuf
+func (b *encryptedBuf) Section(off, n int64) ByteBuf {
+	// Sections use their own handle to the encrypted data, so that they're
+	// unaffected by this buffer being closed.
+	return newSection(&encryptedBuf{
+		src:    Retain(b.src),
+		aead:   b.aead,
+		length: b.length,
+	}, off, n)
+}
+
+// Close implements io.Closer
+func (b *encryptedBuf) Close() error {
+	return b.src.Close()
+}
@@ -0,0 +1,133 @@
+package bytebuf
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newEncrypted(t *testing.T, data string) *encryptedBuf {
+	// Use a wrapper type to avoid any specialization.
+	r := struct{ io.Reader }{strings.NewReader(data)}
+
+	buf, err := NewFromReaderWithOptions(r, ReaderOptions{
+		Dir:             t.TempDir(),
+		MemoryThreshold: 4,
+		Encrypt:         true,
+	})
+	require.NoError(t, err)
+	require.IsType(t, &encryptedBuf{}, buf)
+	return buf.(*encryptedBuf)
+}
+
+func TestEncryptedBuf(t *testing.T) {
+	const expected = `foobarbazasdf`
+	testByteBufImpl(t, newEncrypted(t, expected), expected)
+}
+
+func TestEncryptedBufLarge(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	data := make([]byte, 3*encryptedChunkSize+123)
+	rnd.Read(data)
+
+	buf := newEncrypted(t, string(data))
+	defer buf.Close()
+	assert.EqualValues(t, len(data), buf.Length())
+
+	// The data on disk isn't the plaintext.
+	f := buf.src.(*fileBuf).f
+	onDisk, err := ioutil.ReadAll(io.NewSectionReader(f, 0, 1<<30))
+	require.NoError(t, err)
+	assert.Len(t, onDisk, len(data)+4*encryptedChunkOverhead)
+	assert.False(t, bytes.Contains(onDisk, data[:64]))
+
+	// Reads that span chunks.
+	for i := 0; i < 100; i++ {
+		off := rnd.Intn(len(data))
+		n := rnd.Intn(2 * encryptedChunkSize)
+		if off+n > len(data) {
+			n = len(data) - off
+		}
+
+		p := make([]byte, n)
+		read, err := buf.ReadAt(p, int64(off))
+		require.NoError(t, err)
+		require.Equal(t, n, read)
+		require.True(t, bytes.Equal(data[off:off+n], p), "data mismatch at %d+%d", off, n)
+	}
+
+	var out bytes.Buffer
+	_, err = buf.WriteTo(&out)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, out.Bytes()))
+
+	section := buf.Section(encryptedChunkSize-10, 20)
+	assert.Equal(t, string(data[encryptedChunkSize-10:encryptedChunkSize+10]), mustReadAll(t, section))
+	section.Close()
+}
+
+func TestEncryptedBufTampered(t *testing.T) {
+	data := strings.Repeat("secret data\n", encryptedChunkSize/4)
+
+	t.Run("Modified", func(t *testing.T) {
+		buf := newEncrypted(t, data)
+		defer buf.Close()
+
+		// Flip a bit in the second chunk.
+		f := buf.src.(*fileBuf).f
+		var b [1]byte
+		off := int64(encryptedChunkSize + encryptedChunkOverhead + 100)
+		_, err := f.ReadAt(b[:], off)
+		require.NoError(t, err)
+		b[0] ^= 1
+		_, err = f.WriteAt(b[:], off)
+		require.NoError(t, err)
+
+		// The first chunk is still readable...
+		p := make([]byte, 100)
+		_, err = buf.ReadAt(p, 0)
+		assert.NoError(t, err)
+
+		// ... but the second isn't.
+		_, err = buf.ReadAt(p, encryptedChunkSize+50)
+		assert.Equal(t, ErrTampered, err)
+		_, err = ReadAll(buf)
+		assert.Equal(t, ErrTampered, err)
+	})
+
+	t.Run("Reordered", func(t *testing.T) {
+		buf := newEncrypted(t, data)
+		defer buf.Close()
+
+		// Swap the first two chunks.
+		f := buf.src.(*fileBuf).f
+		size := encryptedChunkSize + encryptedChunkOverhead
+		chunks := make([]byte, 2*size)
+		_, err := f.ReadAt(chunks, 0)
+		require.NoError(t, err)
+		_, err = f.WriteAt(chunks[size:], 0)
+		require.NoError(t, err)
+		_, err = f.WriteAt(chunks[:size], int64(size))
+		require.NoError(t, err)
+
+		_, err = buf.ReadAt(make([]byte, 10), 0)
+		assert.Equal(t, ErrTampered, err)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		buf := newEncrypted(t, data)
+		defer buf.Close()
+
+		f := buf.src.(*fileBuf).f
+		require.NoError(t, f.Truncate(encryptedChunkSize))
+
+		_, err := buf.ReadAt(make([]byte, 10), int64(len(data)-10))
+		assert.Equal(t, ErrTampered, err)
+	})
+}
@@ -4,24 +4,122 @@ import (
 	"io"
 	"net"
 	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"unsafe"
 )
 
 // fileBuf is a ByteBuf that's backed by a File.
 type fileBuf struct {
-	f    *os.File
+	f *os.File
+
+	// off is the offset of this buffer's data within f, and size is the
+	// length of that data.
+	off  int64
 	size int64
+
+	// m is the memory mapping of f, if this buffer was created with
+	// NewFromFileMmap; otherwise it's nil.
+	m *mapping
+
+	// path, if non-empty, is removed after f is closed.
+	path string
+
+	// The handle is shared between this buffer and all sections of it;
+	// f is closed once all of them have been closed.
+	handle
+
+	digestCache
+}
+
+// mapping is a memory mapping of a file that's shared between a fileBuf and
+// all sections of it.
+type mapping struct {
+	// mu protects data; it's held for reading while the mapping is being
+	// accessed, and for writing when the mapping is being unmapped so that
+	// we never unmap memory out from under a concurrent reader.
+	mu   sync.RWMutex
+	data []byte
 }
 
 var _ ByteBuf = (*fileBuf)(nil)
 
 // NewFromFile creates a ByteBuf from an underlying file.
 func NewFromFile(f *os.File) (ByteBuf, error) {
+	return newFileBuf(f)
+}
+
+func newFileBuf(f *os.File) (*fileBuf, error) {
 	st, err := f.Stat()
 	if err != nil {
 		return nil, err
 	}
 
 	ret := &fileBuf{f: f, size: st.Size()}
+	ret.ref = newRefCount(ret.release)
+	return ret, nil
+}
+
+// MmapAdvice is a hint to the kernel about how the data in a memory-mapped
+// ByteBuf will be accessed; see madvise(2).
+type MmapAdvice int
+
+const (
+	// MmapNormal indicates no particular access pattern.
+	MmapNormal MmapAdvice = iota
+
+	// MmapSequential indicates that the data will be accessed
+	// sequentially, so the kernel can read ahead aggressively.
+	MmapSequential
+
+	// MmapRandom indicates that the data will be accessed in a random
+	// order, so read-ahead is unlikely to be useful.
+	MmapRandom
+
+	// MmapWillNeed indicates that all the data will be accessed soon, so
+	// the kernel should start reading it in.
+	MmapWillNeed
+)
+
+// NewFromFileMmap creates a ByteBuf from an underlying file that serves reads
+// from a read-only memory mapping of the file, which avoids a syscall for
+// every call to ReadAt. WriteTo will still copy directly from the file with
+// sendfile(2) or copy_file_range(2) when possible.
+//
+// The provided advice is passed to the kernel. On platforms that don't
+// support memory mapping, this behaves identically to NewFromFile.
+//
+// If the file is truncated while it's mapped, accessing the mapping past the
+// new end of the file raises SIGBUS. The buffer recovers from this and
+// returns io.ErrUnexpectedEOF from reads and writes of the missing data, but
+// the file still shouldn't be modified while it's mapped.
+func NewFromFileMmap(f *os.File, advice MmapAdvice) (ByteBuf, error) {
+	ret, err := newFileBuf(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// Empty files can't be mapped, and files that don't fit in our
+	// address space shouldn't be; just read them normally.
+	if ret.size == 0 || int64(int(ret.size)) != ret.size {
+		return ret, nil
+	}
+
+	data, err := mmapFile(f, int(ret.size))
+	if err == errMmapUnsupported {
+		return ret, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := madvise(data, advice); err != nil {
+		munmap(data)
+		return nil, err
+	}
+
+	ret.m = &mapping{data: data}
 	return ret, nil
 }
 
@@ -31,8 +129,8 @@ func (b *fileBuf) Length() int64 {
 }
 
 // AsReader implements ByteBuf
-func (b *fileBuf) AsReader() io.Reader {
-	return io.NewSectionReader(b, 0, b.size)
+func (b *fileBuf) AsReader() *Reader {
+	return NewReader(b)
 }
 
 // WriteTo implements io.WriterTo
@@ -42,26 +140,162 @@ func (b *fileBuf) WriteTo(w io.Writer) (n int64, err error) {
 	case *os.File:
 		// Try to use copy_file_range(2) to copy directly from the file
 		// to the output file.
-		n, handled, err = maybeCopyFileRange(v, b.f, b.size)
+		n, handled, err = maybeCopyFileRange(v, b.f, b.off, b.size)
+
+		// copy_file_range(2) doesn't support pipes; if the output
+		// is a pipe, we can use splice(2) instead.
+		if !handled {
+			n, handled, err = maybeSplice(v, b.f, b.off, b.size)
+		}
 
 	case *net.TCPConn:
 		// Try to use sendfile(2) to copy data directly from the file
 		// to the connection.
-		n, handled, err = maybeSendfile(v, b.f, b.size)
+		n, handled, err = maybeSendfile(v, b.f, b.off, b.size)
+
+	case *net.UnixConn:
+		// sendfile(2) also supports Unix sockets.
+		n, handled, err = maybeSendfile(v, b.f, b.off, b.size)
 	}
 	if handled {
 		return
 	}
 
-	n, err = io.Copy(w, b.AsReader())
+	// Data in a mapping is copied out of it by ReadAt, rather than being
+	// written directly, so that a fault from a truncated file can be
+	// recovered from without also catching any faults in w.Write.
+	n, err = io.Copy(w, io.NewSectionReader(b, 0, b.size))
+	if err == nil && n < b.size {
+		// The file was truncated after the buffer was created.
+		err = io.ErrUnexpectedEOF
+	}
 	return
 }
 
 // ReadAt implements io.ReaderAt
 func (b *fileBuf) ReadAt(p []byte, off int64) (int, error) {
-	return b.f.ReadAt(p, off)
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+	if off >= b.size {
+		return 0, io.EOF
+	}
+
+	// Don't read past the end of this buffer, which might not be the end
+	// of the file if this is a section.
+	if max := b.size - off; int64(len(p)) > max {
+		n, err := b.readAt(p[:max], b.off+off)
+		if err == nil {
+			err = io.EOF
+		}
+		return n, err
+	}
+	return b.readAt(p, b.off+off)
+}
+
+// readAt reads from the given offset in the underlying file, which must be
+// within the bounds of the file.
+func (b *fileBuf) readAt(p []byte, off int64) (int, error) {
+	if b.m == nil {
+		return b.f.ReadAt(p, off)
+	}
+
+	b.m.mu.RLock()
+	defer b.m.mu.RUnlock()
+
+	if b.m.data == nil {
+		return 0, os.ErrClosed
+	}
+
+	var n int
+	err := guardMapping(b.m.data, func() {
+		n = copy(p, b.m.data[off:])
+	})
+	return n, err
+}
+
+// guardMapping calls fn, which copies data out of the mapping data. If the
+// file has been truncated, accessing the mapping past the new end of the file
+// faults; in that case, guardMapping recovers and returns
+// io.ErrUnexpectedEOF instead of crashing the process. Any other panic,
+// including a fault outside of data, is re-raised.
+func guardMapping(data []byte, fn func()) (err error) {
+	old := debug.SetPanicOnFault(true)
+	defer func() {
+		debug.SetPanicOnFault(old)
+		if r := recover(); r != nil {
+			if !isMappingFault(r, data) {
+				panic(r)
+			}
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+	fn()
+	return nil
+}
+
+// isMappingFault returns whether r, a value returned by recover, is the panic
+// caused by a memory fault within data while debug.SetPanicOnFault is
+// enabled.
+func isMappingFault(r interface{}, data []byte) bool {
+	err, ok := r.(runtime.Error)
+	if !ok {
+		return false
+	}
+
+	// Since Go 1.17, the runtime reports the faulting address.
+	if addrErr, ok := err.(interface{ Addr() uintptr }); ok {
+		if len(data) == 0 {
+			return false
+		}
+		start := uintptr(unsafe.Pointer(&data[0]))
+		addr := addrErr.Addr()
+		return addr >= start && addr-start < uintptr(len(data))
+	}
+
+	// Otherwise, the best we can do is check the message; depending on
+	// the Go version, faults are reported either as an "unexpected fault
+	// address" or as an invalid memory address.
+	msg := err.Error()
+	return strings.Contains(msg, "fault address") || strings.Contains(msg, "invalid memory address")
+}
+
+// Section implements ByteBuf
+func (b *fileBuf) Section(off, n int64) ByteBuf {
+	off, n = clampSection(off, n, b.size)
+	return &fileBuf{
+		f:      b.f,
+		off:    b.off + off,
+		size:   n,
+		m:      b.m,
+		handle: b.dup(),
+	}
 }
 
 func (b *fileBuf) Close() error {
-	return b.f.Close()
+	return b.close()
+}
+
+// release closes the underlying file, once all handles to it have been
+// closed.
+func (b *fileBuf) release() error {
+	var err error
+	if b.m != nil {
+		b.m.mu.Lock()
+		if b.m.data != nil {
+			err = munmap(b.m.data)
+			b.m.data = nil
+		}
+		b.m.mu.Unlock()
+	}
+
+	if cerr := b.f.Close(); err == nil {
+		err = cerr
+	}
+	if b.path != "" {
+		if rerr := os.Remove(b.path); err == nil {
+			err = rerr
+		}
+	}
+	return err
 }
@@ -53,3 +53,26 @@ func TestFileBufCopyFileRange(t *testing.T) {
 
 	assert.Equal(t, largeBuf, string(data))
 }
+
+func TestCopyFileRangeAt(t *testing.T) {
+	src := makeTempFile(t, "0123456789")
+	defer src.Close()
+	dst := makeTempFile(t, "abcdefghij")
+	defer dst.Close()
+
+	n, handled, err := maybeCopyFileRangeAt(dst, src, 3, 5, 4)
+	if !handled {
+		t.Skip("copy_file_range not supported")
+	}
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, n)
+
+	// The destination file's offset isn't used or changed.
+	off, err := dst.Seek(0, io.SeekCurrent)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, off)
+
+	data, err := ioutil.ReadAll(dst)
+	require.NoError(t, err)
+	assert.Equal(t, "abc5678hij", string(data))
+}
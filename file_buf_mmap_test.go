@@ -0,0 +1,153 @@
+package bytebuf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileBufMmap(t *testing.T) {
+	const expected = `foobarbazasdf`
+
+	advices := []MmapAdvice{MmapNormal, MmapSequential, MmapRandom, MmapWillNeed}
+	for _, advice := range advices {
+		advice := advice
+		t.Run(fmt.Sprintf("Advice=%d", advice), func(t *testing.T) {
+			f := makeTempFile(t, expected)
+			defer f.Close()
+
+			buf, err := NewFromFileMmap(f, advice)
+			if assert.NoError(t, err) {
+				testByteBufImpl(t, buf, expected)
+			}
+		})
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		f := makeTempFile(t, "")
+		defer f.Close()
+
+		buf, err := NewFromFileMmap(f, MmapNormal)
+		require.NoError(t, err)
+		defer buf.Close()
+
+		assert.EqualValues(t, 0, buf.Length())
+	})
+
+	t.Run("Section", func(t *testing.T) {
+		f := makeTempFile(t, expected)
+		defer f.Close()
+
+		buf, err := NewFromFileMmap(f, MmapNormal)
+		require.NoError(t, err)
+		defer buf.Close()
+
+		testByteBufImpl(t, buf.Section(3, 6), expected[3:9])
+	})
+}
+
+func TestFileBufMmapConcurrentClose(t *testing.T) {
+	const expected = `foobarbazasdf`
+
+	f := makeTempFile(t, expected)
+	defer f.Close()
+
+	buf, err := NewFromFileMmap(f, MmapRandom)
+	require.NoError(t, err)
+
+	// Start a bunch of readers, then close the buffer while they're
+	// running; reads must either succeed or fail cleanly, and never
+	// access the unmapped memory.
+	var (
+		wg    sync.WaitGroup
+		start = make(chan struct{})
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			p := make([]byte, 3)
+			for j := 0; j < 1000; j++ {
+				n, err := buf.ReadAt(p, 3)
+				if err != nil {
+					assert.Equal(t, os.ErrClosed, err)
+					return
+				}
+				assert.Equal(t, 3, n)
+				assert.Equal(t, "bar", string(p))
+			}
+		}()
+	}
+
+	close(start)
+	require.NoError(t, buf.Close())
+	wg.Wait()
+}
+
+func TestFileBufMmapTruncated(t *testing.T) {
+	expected := strings.Repeat("0123456789abcdef", 64*1024)
+
+	f := makeTempFile(t, expected)
+	defer f.Close()
+
+	buf, err := NewFromFileMmap(f, MmapNormal)
+	require.NoError(t, err)
+	defer buf.Close()
+
+	// Truncate the file unexpectedly; accessing the mapping past the new
+	// end of the file must return an error rather than crash.
+	require.NoError(t, f.Truncate(10))
+
+	p := make([]byte, 5)
+	n, err := buf.ReadAt(p, 0)
+	require.NoError(t, err)
+	assert.Equal(t, expected[:5], string(p[:n]))
+
+	_, err = buf.ReadAt(p, 512*1024)
+	if buf.(*fileBuf).m != nil {
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+	} else {
+		assert.Error(t, err)
+	}
+
+	var out bytes.Buffer
+	_, err = buf.WriteTo(&out)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	_, err = Digest(buf, SHA256)
+	assert.Error(t, err)
+}
+
+// nilWriter is an io.Writer that dereferences a nil pointer.
+type nilWriter struct {
+	n *int
+}
+
+func (w nilWriter) Write(p []byte) (int, error) {
+	return *w.n, nil
+}
+
+func TestFileBufMmapWriterFault(t *testing.T) {
+	buf, err := NewFromFileMmap(makeTempFile(t, "some data"), MmapNormal)
+	require.NoError(t, err)
+	defer buf.Close()
+
+	// Faults outside of the mapping, such as in the destination, aren't
+	// recovered from.
+	assert.Panics(t, func() { buf.WriteTo(nilWriter{}) })
+	assert.Panics(t, func() {
+		walkSegments(buf, 0, buf.Length(), func(p []byte) error {
+			_, err := nilWriter{}.Write(p)
+			return err
+		})
+	})
+}
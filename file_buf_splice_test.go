@@ -0,0 +1,118 @@
+// +build linux
+
+package bytebuf
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileBufSplice(t *testing.T) {
+	oldSize := maxSpliceSize
+	maxSpliceSize = 20 * 1024
+	t.Cleanup(func() {
+		maxSpliceSize = oldSize
+	})
+
+	// Use more data than fits in the default pipe buffer, so that we
+	// need to wait for the pipe to become writable.
+	const ss = "i'm a data line\n"
+	largeBuf := strings.Repeat(ss, (256*1024)/len(ss))
+
+	f := makeTempFile(t, "header"+largeBuf)
+	defer f.Close()
+	require.NoError(t, f.Sync())
+
+	buf, err := NewFromFile(f)
+	require.NoError(t, err)
+	defer buf.Close()
+
+	// Use a section to verify that we splice from the right offset.
+	sec := buf.Section(int64(len("header")), int64(len(largeBuf)))
+	defer sec.Close()
+
+	assertCopyViaPipe(t, sec, largeBuf)
+
+	// Also call maybeSplice directly, since WriteTo would fall back to a
+	// regular copy if splice(2) didn't handle the write.
+	t.Run("NonBlocking", func(t *testing.T) {
+		pr, pw, err := os.Pipe()
+		require.NoError(t, err)
+		assertSpliceViaPipe(t, pr, pw, f, int64(len("header")), largeBuf)
+	})
+
+	// A pipe that's in blocking mode, such as a standard stream inherited
+	// from a shell pipeline, can't be waited on by the runtime.
+	t.Run("Blocking", func(t *testing.T) {
+		var fds [2]int
+		require.NoError(t, syscall.Pipe(fds[:]))
+		pr := os.NewFile(uintptr(fds[0]), "pipe-r")
+		pw := os.NewFile(uintptr(fds[1]), "pipe-w")
+		assertSpliceViaPipe(t, pr, pw, f, int64(len("header")), largeBuf)
+
+		require.NoError(t, syscall.Pipe(fds[:]))
+		pr = os.NewFile(uintptr(fds[0]), "pipe-r")
+		pw = os.NewFile(uintptr(fds[1]), "pipe-w")
+		defer pr.Close()
+		defer pw.Close()
+
+		// The fallback for writing to a blocking pipe via WriteTo.
+		go func() {
+			_, err := sec.WriteTo(pw)
+			assert.NoError(t, err)
+			pw.Close()
+		}()
+		var out bytes.Buffer
+		_, err := io.Copy(&out, pr)
+		require.NoError(t, err)
+		assert.Equal(t, largeBuf, out.String())
+	})
+}
+
+// assertSpliceViaPipe splices the data at off in f to the pipe pw with
+// maybeSplice, and asserts that it's handled and that the data read from pr
+// matches the expected value. It closes both ends of the pipe.
+func assertSpliceViaPipe(t *testing.T, pr, pw, f *os.File, off int64, expected string) {
+	defer pr.Close()
+	defer pw.Close()
+
+	var (
+		out      bytes.Buffer
+		readDone = make(chan struct{})
+	)
+	go func() {
+		defer close(readDone)
+		_, err := io.Copy(&out, pr)
+		assert.NoError(t, err)
+	}()
+
+	n, handled, err := maybeSplice(pw, f, off, int64(len(expected)))
+	require.True(t, handled)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(expected), n)
+
+	pw.Close()
+	<-readDone
+	assert.Equal(t, expected, out.String())
+}
+
+func TestFileBufSendfileUnix(t *testing.T) {
+	const ss = "i'm a data line\n"
+	largeBuf := strings.Repeat(ss, (maxSendfileSize/len(ss))+1)
+
+	f := makeTempFile(t, largeBuf)
+	defer f.Close()
+	require.NoError(t, f.Sync())
+
+	buf, err := NewFromFile(f)
+	if assert.NoError(t, err) {
+		assertCopyViaUnixConn(t, buf, largeBuf)
+	}
+}
@@ -0,0 +1,404 @@
+package bytebuf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+// DefaultGzipIndexSpan is the default distance, in bytes of uncompressed data,
+// between the checkpoints in a GzipIndex.
+const DefaultGzipIndexSpan = 1024 * 1024
+
+var (
+	errGzipIndexMismatch = errors.New("bytebuf: gzip index doesn't match compressed data")
+	errGzipIndexCorrupt  = errors.New("bytebuf: corrupt gzip index")
+)
+
+// gzipIndexMagic identifies a serialized GzipIndex.
+var gzipIndexMagic = [8]byte{'B', 'B', 'G', 'Z', 'I', 'D', 'X', 1}
+
+// GzipIndex is an index of gzip-compressed data that allows decompression to
+// start at points other than the beginning of the data. It contains a
+// checkpoint at the start of each gzip member and at regular intervals within
+// them, which records the state of the decompressor at that point; each
+// checkpoint uses up to 32KiB of memory.
+type GzipIndex struct {
+	checkpoints    []gzipCheckpoint
+	length         int64
+	compressedSize int64
+}
+
+// gzipCheckpoint is a point at which decompression can begin.
+type gzipCheckpoint struct {
+	// in is the offset of the checkpoint within the compressed data, in
+	// bits, and out is its offset within the uncompressed data.
+	in, out int64
+
+	// window contains the data preceding this checkpoint (within the same
+	// gzip member) that can be referred to by the compressed data.
+	window []byte
+}
+
+// BuildGzipIndex decompresses all of the gzip-compressed data in b, and
+// returns an index with checkpoints at most every span bytes of uncompressed
+// data. If span is zero, DefaultGzipIndexSpan is used; smaller spans result in
+// faster random access at the cost of a larger index.
+func BuildGzipIndex(b ByteBuf, span int64) (*GzipIndex, error) {
+	if span <= 0 {
+		span = DefaultGzipIndexSpan
+	}
+
+	g := newGzipIndexer(b.AsReader(), span)
+	if err := g.run(); err != nil {
+		return nil, err
+	}
+
+	return &GzipIndex{
+		checkpoints:    g.checkpoints,
+		length:         g.out,
+		compressedSize: b.Length(),
+	}, nil
+}
+
+// Length returns the length of the uncompressed data.
+func (x *GzipIndex) Length() int64 {
+	return x.length
+}
+
+// find returns the index of the last checkpoint at or before the given offset
+// in the uncompressed data.
+func (x *GzipIndex) find(off int64) int {
+	i := sort.Search(len(x.checkpoints), func(i int) bool {
+		return x.checkpoints[i].out > off
+	})
+	return i - 1
+}
+
+// WriteTo writes a serialized form of the index to w, which can be read with
+// ReadGzipIndex.
+func (x *GzipIndex) WriteTo(w io.Writer) (n int64, err error) {
+	var header [28]byte
+	copy(header[:8], gzipIndexMagic[:])
+	binary.LittleEndian.PutUint64(header[8:], uint64(x.compressedSize))
+	binary.LittleEndian.PutUint64(header[16:], uint64(x.length))
+	binary.LittleEndian.PutUint32(header[24:], uint32(len(x.checkpoints)))
+
+	bw := bufio.NewWriter(w)
+	currN, _ := bw.Write(header[:])
+	n += int64(currN)
+
+	for _, cp := range x.checkpoints {
+		var buf [20]byte
+		binary.LittleEndian.PutUint64(buf[:], uint64(cp.in))
+		binary.LittleEndian.PutUint64(buf[8:], uint64(cp.out))
+		binary.LittleEndian.PutUint32(buf[16:], uint32(len(cp.window)))
+
+		currN, _ = bw.Write(buf[:])
+		n += int64(currN)
+		currN, _ = bw.Write(cp.window)
+		n += int64(currN)
+	}
+
+	// Any write errors are returned from Flush.
+	return n, bw.Flush()
+}
+
+// ReadGzipIndex reads an index that was written with GzipIndex.WriteTo.
+func ReadGzipIndex(r io.Reader) (*GzipIndex, error) {
+	br := bufio.NewReader(r)
+
+	var header [28]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:8], gzipIndexMagic[:]) {
+		return nil, errGzipIndexCorrupt
+	}
+
+	x := &GzipIndex{
+		compressedSize: int64(binary.LittleEndian.Uint64(header[8:])),
+		length:         int64(binary.LittleEndian.Uint64(header[16:])),
+	}
+	count := binary.LittleEndian.Uint32(header[24:])
+
+	for i := uint32(0); i < count; i++ {
+		var buf [20]byte
+		if _, err := io.ReadFull(br, buf[:]); err != nil {
+			return nil, err
+		}
+
+		cp := gzipCheckpoint{
+			in:  int64(binary.LittleEndian.Uint64(buf[:])),
+			out: int64(binary.LittleEndian.Uint64(buf[8:])),
+		}
+		windowLen := binary.LittleEndian.Uint32(buf[16:])
+
+		// Sanity-check the checkpoint, so that we don't allocate huge
+		// windows or read out of bounds later.
+		if windowLen > maxWindowSize ||
+			cp.in < 0 || cp.in > x.compressedSize*8 ||
+			cp.out < 0 || cp.out > x.length {
+			return nil, errGzipIndexCorrupt
+		}
+		if n := len(x.checkpoints); n > 0 && (cp.in <= x.checkpoints[n-1].in || cp.out < x.checkpoints[n-1].out) {
+			return nil, errGzipIndexCorrupt
+		}
+
+		if windowLen > 0 {
+			cp.window = make([]byte, windowLen)
+			if _, err := io.ReadFull(br, cp.window); err != nil {
+				return nil, err
+			}
+		}
+		x.checkpoints = append(x.checkpoints, cp)
+	}
+
+	if len(x.checkpoints) == 0 || x.checkpoints[0].out != 0 {
+		return nil, errGzipIndexCorrupt
+	}
+	return x, nil
+}
+
+// gzipBuf is a ByteBuf that contains the uncompressed contents of a
+// gzip-compressed ByteBuf.
+type gzipBuf struct {
+	src   ByteBuf
+	index *GzipIndex
+
+	// cursor is a decompressor that's positioned after the data returned
+	// by the previous call to ReadAt, so that sequential reads can
+	// continue from there.
+	mu     sync.Mutex
+	cursor *gzipCursor
+
+	digestCache
+}
+
+var _ ByteBuf = (*gzipBuf)(nil)
+
+// NewFromGzip creates a ByteBuf containing the uncompressed contents of the
+// gzip-compressed data in b, which may contain multiple gzip members. Reading
+// from the returned buffer at any offset only decompresses data from the
+// closest preceding checkpoint in the provided index, which must have been
+// built from the same data. If index is nil, one is built with the default
+// span, which requires decompressing all the data.
+//
+// The returned ByteBuf takes ownership of b.
+func NewFromGzip(b ByteBuf, index *GzipIndex) (ByteBuf, error) {
+	if index == nil {
+		var err error
+		if index, err = BuildGzipIndex(b, 0); err != nil {
+			return nil, err
+		}
+	}
+	if index.compressedSize != b.Length() {
+		return nil, errGzipIndexMismatch
+	}
+
+	return &gzipBuf{src: b, index: index}, nil
+}
+
+// Length implements ByteBuf
+func (b *gzipBuf) Length() int64 {
+	return b.index.length
+}
+
+// AsReader implements ByteBuf
+func (b *gzipBuf) AsReader() *Reader {
+	return NewReader(b)
+}
+
+// WriteTo implements io.WriterTo
+func (b *gzipBuf) WriteTo(w io.Writer) (n int64, err error) {
+	return io.Copy(w, &gzipReader{b: b})
+}
+
+// ReadAt implements io.ReaderAt
+func (b *gzipBuf) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+	if off >= b.Length() {
+		return 0, io.EOF
+	}
+
+	want := p
+	if max := b.Length() - off; int64(len(want)) > max {
+		want = want[:max]
+	}
+
+	// Use the cached cursor if it's no further from the offset than the
+	// closest checkpoint; otherwise, start a new one.
+	b.mu.Lock()
+	c := b.cursor
+	b.cursor = nil
+	b.mu.Unlock()
+
+	if c == nil || c.out > off || c.out < b.index.checkpoints[b.index.find(off)].out {
+		var err error
+		if c, err = b.newCursor(off); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := c.readAt(want, off)
+	if err != nil {
+		return n, err
+	}
+
+	b.mu.Lock()
+	b.cursor = c
+	b.mu.Unlock()
+
+	if len(want) < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Section implements ByteBuf
+func (b *gzipBuf) Section(off, n int64) ByteBuf {
+	// Sections use their own handle to the compressed data, so that
+	// they're unaffected by this buffer being closed.
+	return newSection(&gzipBuf{src: Retain(b.src), index: b.index}, off, n)
+}
+
+// Close implements io.Closer
+func (b *gzipBuf) Close() error {
+	b.mu.Lock()
+	b.cursor = nil
+	b.mu.Unlock()
+
+	return b.src.Close()
+}
+
+// gzipReader reads a gzipBuf sequentially with its own cursor.
+type gzipReader struct {
+	b   *gzipBuf
+	c   *gzipCursor
+	off int64
+}
+
+func (r *gzipReader) Read(p []byte) (int, error) {
+	if r.off >= r.b.Length() {
+		return 0, io.EOF
+	}
+	if r.c == nil {
+		var err error
+		if r.c, err = r.b.newCursor(0); err != nil {
+			return 0, err
+		}
+	}
+
+	if max := r.b.Length() - r.off; int64(len(p)) > max {
+		p = p[:max]
+	}
+	n, err := r.c.readAt(p, r.off)
+	r.off += int64(n)
+	return n, err
+}
+
+// gzipCursor decompresses data sequentially, starting at a checkpoint.
+type gzipCursor struct {
+	index *GzipIndex
+	src   ByteBuf
+
+	// i is the index of the checkpoint that r started at, and out is the
+	// offset of the next byte that r will return.
+	i   int
+	r   io.ReadCloser
+	out int64
+}
+
+// newCursor returns a cursor at the closest checkpoint before off.
+func (b *gzipBuf) newCursor(off int64) (*gzipCursor, error) {
+	c := &gzipCursor{index: b.index, src: b.src}
+	if err := c.start(b.index.find(off)); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// start starts decompressing at the given checkpoint.
+func (c *gzipCursor) start(i int) error {
+	cp := c.index.checkpoints[i]
+
+	// If the checkpoint isn't at a byte boundary, then we need to skip
+	// the bits of the first byte that precede it; compress/flate has no
+	// way to do that, so instead we replace those bits with blocks that
+	// don't produce any output. This keeps the rest of the data at the
+	// same alignment, which matters for stored blocks.
+	off, shift := cp.in/8, uint(cp.in%8)
+	var r io.Reader = io.NewSectionReader(c.src, off, c.src.Length()-off)
+	if shift != 0 {
+		var first [1]byte
+		if _, err := c.src.ReadAt(first[:], off); err != nil {
+			return err
+		}
+
+		prefix := deflateEmptyBlocks(shift)
+		prefix[len(prefix)-1] |= first[0] &^ (1<<shift - 1)
+		r = io.MultiReader(
+			bytes.NewReader(prefix),
+			io.NewSectionReader(c.src, off+1, c.src.Length()-off-1),
+		)
+	}
+
+	c.i = i
+	c.out = cp.out
+	c.r = flate.NewReaderDict(r, cp.window)
+	return nil
+}
+
+// readAt reads len(p) bytes of uncompressed data at off, which must not be
+// before the cursor's current position.
+func (c *gzipCursor) readAt(p []byte, off int64) (int, error) {
+	if skip := off - c.out; skip > 0 {
+		if _, err := io.CopyN(ioutil.Discard, readerFunc(c.read), skip); err != nil {
+			return 0, err
+		}
+	}
+	return io.ReadFull(readerFunc(c.read), p)
+}
+
+// read reads from the current gzip member, moving to the next member once it's
+// complete, and advances the cursor's position.
+func (c *gzipCursor) read(p []byte) (int, error) {
+	for {
+		n, err := c.r.Read(p)
+		c.out += int64(n)
+		if err != io.EOF {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+
+		// This member is complete, so start the next one; the next
+		// checkpoint that starts at this offset is its first.
+		next := c.index.find(c.out)
+		if next <= c.i {
+			if c.out < c.index.length {
+				return 0, io.ErrUnexpectedEOF
+			}
+			return 0, io.EOF
+		}
+		if err := c.start(next); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// readerFunc adapts a function to an io.Reader.
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
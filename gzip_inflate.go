@@ -0,0 +1,699 @@
+package bytebuf
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+// This file contains a DEFLATE decoder that's used to build a GzipIndex. The
+// decoder in compress/flate doesn't expose the position of each block within
+// the compressed data, which we need to know in order to resume decompression
+// from that point, so we decode the data ourselves. Reading from the index is
+// done with compress/flate.
+
+const (
+	// maxWindowSize is the maximum distance of a back-reference in DEFLATE
+	// data, and thus the amount of history needed to resume decompression.
+	maxWindowSize = 32 * 1024
+
+	// maxMatchLength is the maximum length of a back-reference.
+	maxMatchLength = 258
+
+	// fastHuffmanBits is the number of bits that are decoded with a single
+	// table lookup; longer codes are decoded bit-by-bit.
+	fastHuffmanBits = 9
+)
+
+// inflateBitReader reads bits from DEFLATE data, least-significant bit first,
+// and tracks the position within the data.
+type inflateBitReader struct {
+	r     *bufio.Reader
+	pos   int64 // number of bytes read from r
+	bits  uint32
+	nbits uint
+}
+
+// bitOffset returns the offset of the next unread bit.
+func (br *inflateBitReader) bitOffset() int64 {
+	return br.pos*8 - int64(br.nbits)
+}
+
+// corrupt returns an error for corrupt data at the current position.
+func (br *inflateBitReader) corrupt() error {
+	return flate.CorruptInputError(br.pos)
+}
+
+// fill reads bytes until at least n bits are available.
+func (br *inflateBitReader) fill(n uint) error {
+	for br.nbits < n {
+		c, err := br.r.ReadByte()
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		} else if err != nil {
+			return err
+		}
+		br.bits |= uint32(c) << br.nbits
+		br.nbits += 8
+		br.pos++
+	}
+	return nil
+}
+
+// readBits reads an n-bit value, where n <= 24.
+func (br *inflateBitReader) readBits(n uint) (uint32, error) {
+	if err := br.fill(n); err != nil {
+		return 0, err
+	}
+	v := br.bits & (1<<n - 1)
+	br.bits >>= n
+	br.nbits -= n
+	return v, nil
+}
+
+// alignToByte discards any bits remaining in the current byte.
+func (br *inflateBitReader) alignToByte() {
+	n := br.nbits % 8
+	br.bits >>= n
+	br.nbits -= n
+}
+
+// readFull reads len(p) bytes, which must start on a byte boundary.
+func (br *inflateBitReader) readFull(p []byte) error {
+	for len(p) > 0 && br.nbits > 0 {
+		p[0] = byte(br.bits)
+		br.bits >>= 8
+		br.nbits -= 8
+		p = p[1:]
+	}
+
+	n, err := io.ReadFull(br.r, p)
+	br.pos += int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// atEOF returns whether all the data has been read.
+func (br *inflateBitReader) atEOF() (bool, error) {
+	if br.nbits > 0 {
+		return false, nil
+	}
+	_, err := br.r.Peek(1)
+	if err == io.EOF {
+		return true, nil
+	}
+	return false, err
+}
+
+// huffmanDecoder decodes canonical Huffman codes, as described in RFC 1951.
+type huffmanDecoder struct {
+	// counts contains the number of codes of each length, and symbols
+	// contains the symbols ordered by code.
+	counts  [16]uint16
+	symbols [288]uint16
+
+	// fast maps the next fastHuffmanBits bits of input to the symbol
+	// (in the upper bits) and code length (in the lower 4 bits), or zero
+	// if the code is longer than that.
+	fast [1 << fastHuffmanBits]uint16
+}
+
+// init initializes the decoder from the code length of each symbol.
+func (h *huffmanDecoder) init(lengths []uint8) bool {
+	h.counts = [16]uint16{}
+	for _, l := range lengths {
+		h.counts[l]++
+	}
+
+	// Check that the code isn't over-subscribed; incomplete codes are
+	// allowed, and decoding fails if one of the missing codes is used.
+	left := 1
+	for l := 1; l < 16; l++ {
+		left <<= 1
+		left -= int(h.counts[l])
+		if left < 0 {
+			return false
+		}
+	}
+
+	// Compute the offset of the first symbol of each length within
+	// symbols, and the first code of each length (see RFC 1951, section
+	// 3.2.2).
+	var offsets, next [16]uint16
+	code := uint16(0)
+	for l := 1; l < 15; l++ {
+		offsets[l+1] = offsets[l] + h.counts[l]
+		code = (code + h.counts[l]) << 1
+		next[l+1] = code
+	}
+
+	h.fast = [1 << fastHuffmanBits]uint16{}
+	for sym, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		h.symbols[offsets[l]] = uint16(sym)
+		offsets[l]++
+
+		code := next[l]
+		next[l]++
+		if l > fastHuffmanBits {
+			continue
+		}
+
+		// Codes are stored most-significant bit first, so reverse
+		// the code to get the bits as we read them.
+		rev := uint16(0)
+		for i := uint8(0); i < l; i++ {
+			rev = rev<<1 | (code>>i)&1
+		}
+		for i := rev; i < 1<<fastHuffmanBits; i += 1 << l {
+			h.fast[i] = uint16(sym)<<4 | uint16(l)
+		}
+	}
+	return true
+}
+
+// decode reads and decodes the next symbol.
+func (h *huffmanDecoder) decode(br *inflateBitReader) (int, error) {
+	// Read as many bits as are available, up to fastHuffmanBits; near
+	// the end of the data, there may be fewer bits than that.
+	for br.nbits < fastHuffmanBits {
+		c, err := br.r.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+		br.bits |= uint32(c) << br.nbits
+		br.nbits += 8
+		br.pos++
+	}
+
+	if e := h.fast[br.bits&(1<<fastHuffmanBits-1)]; e != 0 && uint(e&15) <= br.nbits {
+		br.bits >>= e & 15
+		br.nbits -= uint(e & 15)
+		return int(e >> 4), nil
+	}
+
+	// Slow path: decode one bit at a time.
+	code, first, index := 0, 0, 0
+	for l := 1; l < 16; l++ {
+		bit, err := br.readBits(1)
+		if err != nil {
+			return 0, err
+		}
+		code |= int(bit)
+
+		count := int(h.counts[l])
+		if code-first < count {
+			return int(h.symbols[index+code-first]), nil
+		}
+		index += count
+		first += count
+		first <<= 1
+		code <<= 1
+	}
+	return 0, br.corrupt()
+}
+
+var (
+	// Base values and extra bits for length and distance codes.
+	lengthBase = [29]uint16{
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31,
+		35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258,
+	}
+	lengthExtra = [29]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2,
+		3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0,
+	}
+	distBase = [30]uint16{
+		1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193,
+		257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145,
+		8193, 12289, 16385, 24577,
+	}
+	distExtra = [30]uint8{
+		0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6,
+		7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13,
+	}
+
+	// Order in which code length code lengths are stored.
+	codeLengthOrder = [19]uint8{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+)
+
+// gzipIndexer decompresses gzip data, recording a checkpoint at the start of
+// each gzip member and at block boundaries at most every span bytes of
+// uncompressed output.
+type gzipIndexer struct {
+	br   inflateBitReader
+	span int64
+
+	// hist contains the output of the current member that hasn't been
+	// checksummed, preceded by up to maxWindowSize bytes of earlier
+	// output; out is the total amount of output so far.
+	hist    []byte
+	summed  int
+	crc     uint32
+	out     int64
+	lastOut int64
+
+	lit, dist huffmanDecoder
+
+	checkpoints []gzipCheckpoint
+}
+
+func newGzipIndexer(r io.Reader, span int64) *gzipIndexer {
+	return &gzipIndexer{
+		br:   inflateBitReader{r: bufio.NewReaderSize(r, 64*1024)},
+		span: span,
+		hist: make([]byte, 0, 4*maxWindowSize),
+	}
+}
+
+// run decompresses all the data, recording checkpoints.
+func (g *gzipIndexer) run() error {
+	for {
+		if err := g.readMember(); err != nil {
+			return err
+		}
+
+		// Multiple gzip members can be concatenated.
+		eof, err := g.br.atEOF()
+		if err != nil {
+			return err
+		} else if eof {
+			return nil
+		}
+	}
+}
+
+// readMember reads a single gzip member, including its header and trailer.
+func (g *gzipIndexer) readMember() error {
+	if err := g.readHeader(); err != nil {
+		return err
+	}
+
+	g.hist = g.hist[:0]
+	g.summed = 0
+	g.crc = 0
+	memberStart := g.out
+	g.checkpoint()
+
+	for {
+		if g.out-g.lastOut >= g.span {
+			g.checkpoint()
+		}
+
+		final, err := g.readBlock()
+		if err != nil {
+			return err
+		}
+		if final {
+			break
+		}
+	}
+
+	// Verify the trailer.
+	g.flushHist()
+	g.br.alignToByte()
+
+	var trailer [8]byte
+	if err := g.br.readFull(trailer[:]); err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint32(trailer[:4]) != g.crc ||
+		binary.LittleEndian.Uint32(trailer[4:]) != uint32(g.out-memberStart) {
+		return gzip.ErrChecksum
+	}
+	return nil
+}
+
+// readHeader reads a gzip member header, as described in RFC 1952.
+func (g *gzipIndexer) readHeader() error {
+	const (
+		flagHeaderCRC = 1 << 1
+		flagExtra     = 1 << 2
+		flagName      = 1 << 3
+		flagComment   = 1 << 4
+	)
+
+	var header [10]byte
+	if err := g.br.readFull(header[:]); err != nil {
+		return err
+	}
+	if header[0] != 0x1f || header[1] != 0x8b || header[2] != 8 || header[3]&0xe0 != 0 {
+		return gzip.ErrHeader
+	}
+	flags := header[3]
+
+	var buf [2]byte
+	if flags&flagExtra != 0 {
+		if err := g.br.readFull(buf[:]); err != nil {
+			return err
+		}
+		extra := make([]byte, binary.LittleEndian.Uint16(buf[:]))
+		if err := g.br.readFull(extra); err != nil {
+			return err
+		}
+	}
+	for _, flag := range []byte{flagName, flagComment} {
+		if flags&flag == 0 {
+			continue
+		}
+
+		// Skip a zero-terminated string.
+		for {
+			if err := g.br.readFull(buf[:1]); err != nil {
+				return err
+			}
+			if buf[0] == 0 {
+				break
+			}
+		}
+	}
+	if flags&flagHeaderCRC != 0 {
+		if err := g.br.readFull(buf[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkpoint records a checkpoint at the current position.
+func (g *gzipIndexer) checkpoint() {
+	window := g.hist
+	if len(window) > maxWindowSize {
+		window = window[len(window)-maxWindowSize:]
+	}
+
+	g.checkpoints = append(g.checkpoints, gzipCheckpoint{
+		in:     g.br.bitOffset(),
+		out:    g.out,
+		window: append([]byte(nil), window...),
+	})
+	g.lastOut = g.out
+}
+
+// flushHist checksums any new output, and discards any output that's no
+// longer needed for back-references.
+func (g *gzipIndexer) flushHist() {
+	g.crc = crc32.Update(g.crc, crc32.IEEETable, g.hist[g.summed:])
+	g.summed = len(g.hist)
+
+	if len(g.hist) > maxWindowSize {
+		n := copy(g.hist, g.hist[len(g.hist)-maxWindowSize:])
+		g.hist = g.hist[:n]
+		g.summed = n
+	}
+}
+
+// reserve ensures that there's space for at least n more bytes of output.
+func (g *gzipIndexer) reserve(n int) {
+	if len(g.hist)+n > cap(g.hist) {
+		g.flushHist()
+	}
+}
+
+// readBlock reads a single DEFLATE block, returning whether it's the final
+// block.
+func (g *gzipIndexer) readBlock() (final bool, err error) {
+	header, err := g.br.readBits(3)
+	if err != nil {
+		return false, err
+	}
+	final = header&1 != 0
+
+	switch header >> 1 {
+	case 0:
+		err = g.readStored()
+	case 1:
+		g.initFixed()
+		err = g.readCodes()
+	case 2:
+		if err = g.readDynamic(); err == nil {
+			err = g.readCodes()
+		}
+	default:
+		err = g.br.corrupt()
+	}
+	return final, err
+}
+
+func (g *gzipIndexer) readStored() error {
+	g.br.alignToByte()
+
+	var buf [4]byte
+	if err := g.br.readFull(buf[:]); err != nil {
+		return err
+	}
+	n := binary.LittleEndian.Uint16(buf[:2])
+	if n != ^binary.LittleEndian.Uint16(buf[2:]) {
+		return g.br.corrupt()
+	}
+
+	for n > 0 {
+		chunk := int(n)
+		if chunk > maxWindowSize {
+			chunk = maxWindowSize
+		}
+		g.reserve(chunk)
+
+		start := len(g.hist)
+		g.hist = g.hist[:start+chunk]
+		if err := g.br.readFull(g.hist[start:]); err != nil {
+			return err
+		}
+		g.out += int64(chunk)
+		n -= uint16(chunk)
+	}
+	return nil
+}
+
+func (g *gzipIndexer) initFixed() {
+	var lengths [288 + 30]uint8
+	for i := 0; i < 144; i++ {
+		lengths[i] = 8
+	}
+	for i := 144; i < 256; i++ {
+		lengths[i] = 9
+	}
+	for i := 256; i < 280; i++ {
+		lengths[i] = 7
+	}
+	for i := 280; i < 288; i++ {
+		lengths[i] = 8
+	}
+	for i := 288; i < 288+30; i++ {
+		lengths[i] = 5
+	}
+	g.lit.init(lengths[:288])
+	g.dist.init(lengths[288:])
+}
+
+func (g *gzipIndexer) readDynamic() error {
+	counts, err := g.br.readBits(14)
+	if err != nil {
+		return err
+	}
+	nlen := int(counts&0x1f) + 257
+	ndist := int(counts>>5&0x1f) + 1
+	ncode := int(counts>>10) + 4
+	if nlen > 286 || ndist > 30 {
+		return g.br.corrupt()
+	}
+
+	// Read the code for the code lengths.
+	var lengths [288 + 32]uint8
+	for i := 0; i < ncode; i++ {
+		l, err := g.br.readBits(3)
+		if err != nil {
+			return err
+		}
+		lengths[codeLengthOrder[i]] = uint8(l)
+	}
+	var lencode huffmanDecoder
+	if !lencode.init(lengths[:19]) {
+		return g.br.corrupt()
+	}
+
+	// Read the literal/length and distance code lengths, which are
+	// stored as a single sequence.
+	lengths = [288 + 32]uint8{}
+	for i := 0; i < nlen+ndist; {
+		sym, err := lencode.decode(&g.br)
+		if err != nil {
+			return err
+		}
+		if sym < 16 {
+			lengths[i] = uint8(sym)
+			i++
+			continue
+		}
+
+		var (
+			repeat uint32
+			value  uint8
+		)
+		switch sym {
+		case 16:
+			if i == 0 {
+				return g.br.corrupt()
+			}
+			value = lengths[i-1]
+			repeat, err = g.br.readBits(2)
+			repeat += 3
+		case 17:
+			repeat, err = g.br.readBits(3)
+			repeat += 3
+		default:
+			repeat, err = g.br.readBits(7)
+			repeat += 11
+		}
+		if err != nil {
+			return err
+		}
+		if i+int(repeat) > nlen+ndist {
+			return g.br.corrupt()
+		}
+		for ; repeat > 0; repeat-- {
+			lengths[i] = value
+			i++
+		}
+	}
+
+	if lengths[256] == 0 {
+		return g.br.corrupt()
+	}
+	if !g.lit.init(lengths[:nlen]) || !g.dist.init(lengths[nlen:nlen+ndist]) {
+		return g.br.corrupt()
+	}
+	return nil
+}
+
+// readCodes decodes the compressed data in a block using the current codes.
+func (g *gzipIndexer) readCodes() error {
+	for {
+		sym, err := g.lit.decode(&g.br)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case sym < 256:
+			g.reserve(1)
+			g.hist = append(g.hist, byte(sym))
+			g.out++
+			continue
+
+		case sym == 256:
+			return nil
+
+		case sym > 285:
+			return g.br.corrupt()
+		}
+
+		// Decode a back-reference.
+		sym -= 257
+		extra, err := g.br.readBits(uint(lengthExtra[sym]))
+		if err != nil {
+			return err
+		}
+		length := int(lengthBase[sym]) + int(extra)
+
+		dsym, err := g.dist.decode(&g.br)
+		if err != nil {
+			return err
+		}
+		if dsym >= 30 {
+			return g.br.corrupt()
+		}
+		extra, err = g.br.readBits(uint(distExtra[dsym]))
+		if err != nil {
+			return err
+		}
+		dist := int(distBase[dsym]) + int(extra)
+
+		g.reserve(maxMatchLength)
+		if dist > len(g.hist) {
+			return g.br.corrupt()
+		}
+		for i := 0; i < length; i++ {
+			g.hist = append(g.hist, g.hist[len(g.hist)-dist])
+		}
+		g.out += int64(length)
+	}
+}
+
+// deflateEmptyBlocks returns a sequence of non-final DEFLATE blocks that don't
+// produce any output, whose length in bits is congruent to n modulo 8, for
+// 0 < n < 8. The unused bits of the final byte are zero.
+//
+// An empty block with fixed codes is 10 bits long, and the smallest empty
+// block with dynamic codes that compress/flate accepts is 95 bits long; some
+// combination of these has the required length.
+func deflateEmptyBlocks(n uint) []byte {
+	var bw inflateBitWriter
+	if n%2 != 0 {
+		// Dynamic block header, with 257 literal/length codes, 1
+		// distance code, and 19 code length codes.
+		bw.writeBits(2<<1, 3)
+		bw.writeBits(0, 5)
+		bw.writeBits(0, 5)
+		bw.writeBits(15, 4)
+
+		// The code length code has lengths 1 for symbol 18 (repeat
+		// zero), and 2 for symbols 0 and 1; its codes are 0, 10 and 11
+		// respectively.
+		for _, sym := range codeLengthOrder {
+			switch sym {
+			case 18:
+				bw.writeBits(1, 3)
+			case 0, 1:
+				bw.writeBits(2, 3)
+			default:
+				bw.writeBits(0, 3)
+			}
+		}
+
+		// The literal/length code only contains the end-of-block
+		// symbol, with length 1: 256 zero lengths (138 + 118), then a
+		// length of 1. The single distance code has length zero.
+		bw.writeBits(0, 1)
+		bw.writeBits(138-11, 7)
+		bw.writeBits(0, 1)
+		bw.writeBits(118-11, 7)
+		bw.writeBits(3, 2)
+		bw.writeBits(1, 2)
+
+		// End of block.
+		bw.writeBits(0, 1)
+	}
+
+	for bw.nbits%8 != n {
+		// Fixed block header and end of block.
+		bw.writeBits(1<<1, 3)
+		bw.writeBits(0, 7)
+	}
+	return bw.buf
+}
+
+// inflateBitWriter writes bits, least-significant bit first.
+type inflateBitWriter struct {
+	buf   []byte
+	nbits uint
+}
+
+func (bw *inflateBitWriter) writeBits(v uint32, n uint) {
+	for i := uint(0); i < n; i++ {
+		if bw.nbits%8 == 0 {
+			bw.buf = append(bw.buf, 0)
+		}
+		bw.buf[len(bw.buf)-1] |= byte(v>>i&1) << (bw.nbits % 8)
+		bw.nbits++
+	}
+}
@@ -0,0 +1,184 @@
+package bytebuf
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeCompressible returns n bytes of random, but compressible, data.
+func makeCompressible(rnd *rand.Rand, n int) []byte {
+	words := []string{"foo", "bar", "baz", "asdf", "qwer", "hello", "world", "\n"}
+
+	var buf bytes.Buffer
+	for buf.Len() < n {
+		if rnd.Intn(16) == 0 {
+			// Some incompressible data, too.
+			fmt.Fprintf(&buf, "%x", rnd.Int63())
+		} else {
+			buf.WriteString(words[rnd.Intn(len(words))])
+		}
+	}
+	return buf.Bytes()[:n]
+}
+
+func gzipData(t *testing.T, data []byte, level int) []byte {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestGzip(t *testing.T) {
+	const expected = `foobarbazasdf`
+
+	compressed := NewFromSlice(gzipData(t, []byte(expected), gzip.DefaultCompression))
+	testByteBufImpl(t, mustNewFromGzip(t, compressed, nil), expected)
+}
+
+func mustNewFromGzip(t *testing.T, b ByteBuf, index *GzipIndex) ByteBuf {
+	buf, err := NewFromGzip(b, index)
+	require.NoError(t, err)
+	return buf
+}
+
+func TestGzipRandomAccess(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	data := makeCompressible(rnd, 1024*1024+17)
+
+	tests := []struct {
+		Name       string
+		Data       []byte
+		Compressed []byte
+	}{
+		{"Default", data, gzipData(t, data, gzip.DefaultCompression)},
+		{"BestSpeed", data, gzipData(t, data, gzip.BestSpeed)},
+		{"HuffmanOnly", data[:512*1024], gzipData(t, data[:512*1024], gzip.HuffmanOnly)},
+		{"NoCompression", data[:512*1024], gzipData(t, data[:512*1024], gzip.NoCompression)},
+		{"MultiMember", data, bytes.Join([][]byte{
+			gzipData(t, data[:500000], gzip.DefaultCompression),
+			gzipData(t, nil, gzip.DefaultCompression),
+			gzipData(t, data[500000:500001], gzip.NoCompression),
+			gzipData(t, data[500001:], gzip.BestCompression),
+		}, nil)},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			index, err := BuildGzipIndex(NewFromSlice(tt.Compressed), 64*1024)
+			require.NoError(t, err)
+			assert.EqualValues(t, len(tt.Data), index.Length())
+			assert.True(t, len(index.checkpoints) > 1, "checkpoints: %d", len(index.checkpoints))
+
+			// The index can be saved and loaded.
+			var saved bytes.Buffer
+			_, err = index.WriteTo(&saved)
+			require.NoError(t, err)
+			loaded, err := ReadGzipIndex(&saved)
+			require.NoError(t, err)
+			assert.Equal(t, index, loaded)
+
+			file, err := NewFromFile(makeTempFile(t, string(tt.Compressed)))
+			require.NoError(t, err)
+			buf := mustNewFromGzip(t, file, loaded)
+			defer buf.Close()
+			assert.EqualValues(t, len(tt.Data), buf.Length())
+
+			// Random reads.
+			for i := 0; i < 50; i++ {
+				off := rnd.Intn(len(tt.Data))
+				n := rnd.Intn(20000)
+				if off+n > len(tt.Data) {
+					n = len(tt.Data) - off
+				}
+
+				p := make([]byte, n)
+				read, err := buf.ReadAt(p, int64(off))
+				require.NoError(t, err)
+				require.Equal(t, n, read)
+				require.True(t, bytes.Equal(tt.Data[off:off+n], p), "data mismatch at %d+%d", off, n)
+			}
+
+			// Sequential reads, which use the cached cursor.
+			var got []byte
+			p := make([]byte, 7777)
+			for off := int64(0); off < buf.Length(); {
+				n, _ := buf.ReadAt(p, off)
+				got = append(got, p[:n]...)
+				off += int64(n)
+			}
+			assert.True(t, bytes.Equal(tt.Data, got))
+
+			// Reading the entire buffer.
+			all, err := ioutil.ReadAll(buf.AsReader())
+			require.NoError(t, err)
+			assert.True(t, bytes.Equal(tt.Data, all))
+
+			// Sections.
+			section := buf.Section(12345, 54321)
+			assert.Equal(t, string(tt.Data[12345:12345+54321]), mustReadAll(t, section))
+			section.Close()
+		})
+	}
+}
+
+func TestDeflateEmptyBlocks(t *testing.T) {
+	for n := uint(1); n < 8; n++ {
+		prefix := deflateEmptyBlocks(n)
+
+		// Append a final empty block with fixed codes, which must
+		// start n bits into the last byte of the prefix.
+		bw := inflateBitWriter{buf: prefix, nbits: uint(len(prefix)-1)*8 + n}
+		bw.writeBits(1|1<<1, 3)
+		bw.writeBits(0, 7)
+
+		data, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(bw.buf)))
+		if assert.NoError(t, err, "n=%d", n) {
+			assert.Empty(t, data, "n=%d", n)
+		}
+	}
+}
+
+func TestGzipErrors(t *testing.T) {
+	compressed := gzipData(t, []byte("foobarbaz"), gzip.DefaultCompression)
+
+	t.Run("Checksum", func(t *testing.T) {
+		corrupt := append([]byte(nil), compressed...)
+		corrupt[len(corrupt)-5] ^= 0xff
+		_, err := BuildGzipIndex(NewFromSlice(corrupt), 0)
+		assert.Equal(t, gzip.ErrChecksum, err)
+	})
+
+	t.Run("Header", func(t *testing.T) {
+		_, err := BuildGzipIndex(NewFromString("not gzip data"), 0)
+		assert.Equal(t, gzip.ErrHeader, err)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		_, err := BuildGzipIndex(NewFromSlice(compressed[:len(compressed)-3]), 0)
+		assert.Error(t, err)
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		index, err := BuildGzipIndex(NewFromSlice(compressed), 0)
+		require.NoError(t, err)
+		_, err = NewFromGzip(NewFromString("foo"), index)
+		assert.Equal(t, errGzipIndexMismatch, err)
+	})
+
+	t.Run("CorruptIndex", func(t *testing.T) {
+		_, err := ReadGzipIndex(bytes.NewReader([]byte("this is not a gzip index at all")))
+		assert.Equal(t, errGzipIndexCorrupt, err)
+	})
+}
@@ -0,0 +1,361 @@
+package bytebuf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hijackThreshold is the minimum size of a response body, not counting any
+// data in memory, for which ServeByteBufWithOptions writes directly to the
+// underlying connection if ServeOptions.Hijack is set.
+//
+// This is a variable so we can override it in testing.
+var hijackThreshold int64 = 1024 * 1024
+
+// ServeOptions contains options for ServeByteBufWithOptions.
+type ServeOptions struct {
+	// Hijack, if true, allows responses to HTTP/1.x requests without TLS
+	// that contain a large amount of data that isn't in memory to be
+	// written directly to the underlying connection, so that
+	// optimizations like sendfile can be used.
+	//
+	// Hijacking the connection bypasses the http.ResponseWriter, so any
+	// middleware that wraps it doesn't see the status code or body. The
+	// connection is closed after the response rather than being kept
+	// alive, and since it's no longer tracked by the http.Server,
+	// Server.Shutdown doesn't wait for the response to be written. Errors
+	// writing the response are logged to the server's ErrorLog.
+	Hijack bool
+}
+
+// Handler returns an http.Handler that serves the contents of b, as with
+// ServeByteBuf. The handler doesn't take ownership of b, which must remain open
+// while the handler is in use.
+func Handler(b ByteBuf) http.Handler {
+	return HandlerWithOptions(b, ServeOptions{})
+}
+
+// HandlerWithOptions is like Handler, but serves b with
+// ServeByteBufWithOptions and the given options.
+func HandlerWithOptions(b ByteBuf, opts ServeOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ServeByteBufWithOptions(w, req, b, opts)
+	})
+}
+
+// ServeByteBuf replies to the request with the contents of b. It handles GET and
+// HEAD requests, including Range requests with one or more ranges and
+// conditional requests with If-Match, If-None-Match and If-Range.
+//
+// If the response doesn't already have an ETag header, then the ETag is the
+// SHA-256 digest of the data, which is cached on b (see DigestOptions); the
+// first request for a buffer reads all of its data to compute this. If the
+// response doesn't already have a Content-Type header, it's determined from
+// the first 512 bytes of the data with http.DetectContentType.
+//
+// Each range of the data is written with b's WriteTo method. This is
+// equivalent to calling ServeByteBufWithOptions with the zero ServeOptions.
+func ServeByteBuf(w http.ResponseWriter, req *http.Request, b ByteBuf) {
+	ServeByteBufWithOptions(w, req, b, ServeOptions{})
+}
+
+// ServeByteBufWithOptions is like ServeByteBuf, but with the given options.
+func ServeByteBufWithOptions(w http.ResponseWriter, req *http.Request, b ByteBuf, opts ServeOptions) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h := w.Header()
+	etag := h.Get("Etag")
+	if etag == "" {
+		sums, err := DigestWithOptions(b, DigestOptions{Cache: true}, SHA256)
+		if err != nil {
+			http.Error(w, "500 internal server error", http.StatusInternalServerError)
+			return
+		}
+		etag = `"` + hex.EncodeToString(sums[0]) + `"`
+		h.Set("Etag", etag)
+	}
+
+	// Handle conditional requests.
+	if im := req.Header.Get("If-Match"); im != "" && !etagMatches(im, etag, true) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	if inm := req.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag, false) {
+		h.Del("Content-Type")
+		h.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	ctype := h.Get("Content-Type")
+	if ctype == "" {
+		var sniff [512]byte
+		n, _ := b.ReadAt(sniff[:], 0)
+		ctype = http.DetectContentType(sniff[:n])
+		h.Set("Content-Type", ctype)
+	}
+	h.Set("Accept-Ranges", "bytes")
+
+	// Only use the Range header if If-Range (if any) matches our ETag; we
+	// have no modification time to compare a date to.
+	size := b.Length()
+	rangeHeader := req.Header.Get("Range")
+	if ir := req.Header.Get("If-Range"); ir != "" && !etagMatches(ir, etag, true) {
+		rangeHeader = ""
+	}
+
+	ranges, ok := parseRange(rangeHeader, size)
+	if !ok {
+		h.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		http.Error(w, "416 requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	var (
+		code = http.StatusOK
+		body ByteBuf
+	)
+	switch len(ranges) {
+	case 0:
+		body = Retain(b)
+
+	case 1:
+		code = http.StatusPartialContent
+		r := ranges[0]
+		h.Set("Content-Range", r.contentRange(size))
+		body = b.Section(r.start, r.length)
+
+	default:
+		code = http.StatusPartialContent
+		boundary := multipart.NewWriter(ioutil.Discard).Boundary()
+		h.Set("Content-Type", "multipart/byteranges; boundary="+boundary)
+		body = multipartRanges(b, ranges, boundary, ctype)
+	}
+	defer body.Close()
+
+	h.Set("Content-Length", strconv.FormatInt(body.Length(), 10))
+	if req.Method == http.MethodHead {
+		w.WriteHeader(code)
+		return
+	}
+
+	if opts.Hijack && shouldHijack(req, body) {
+		if conn, ok := hijack(w, req, code); ok {
+			defer conn.Close()
+			if _, err := body.WriteTo(conn); err != nil {
+				logf(req, "bytebuf: error writing response to %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+	}
+
+	w.WriteHeader(code)
+	body.WriteTo(w)
+}
+
+// httpRange is a range of a ByteBuf requested with a Range header.
+type httpRange struct {
+	start, length int64
+}
+
+func (r httpRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// parseRange parses a Range header as described in RFC 7233, returning the
+// satisfiable ranges. If the header is empty or invalid, or if the ranges
+// contain more data than the buffer, then no ranges are returned and the
+// entire buffer should be served. If none of the ranges are satisfiable, then
+// ok is false.
+func parseRange(s string, size int64) (ranges []httpRange, ok bool) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(s, prefix) {
+		return nil, true
+	}
+
+	var total int64
+	sawSpec := false
+	for _, spec := range strings.Split(s[len(prefix):], ",") {
+		spec = textproto.TrimString(spec)
+		if spec == "" {
+			continue
+		}
+		sawSpec = true
+
+		i := strings.Index(spec, "-")
+		if i < 0 {
+			return nil, true
+		}
+		first, last := textproto.TrimString(spec[:i]), textproto.TrimString(spec[i+1:])
+
+		var r httpRange
+		if first == "" {
+			// A suffix range: the last N bytes.
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, true
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r = httpRange{start: size - n, length: n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, true
+			}
+
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, true
+				}
+				if end >= size {
+					end = size - 1
+				}
+			}
+			if start >= size {
+				continue
+			}
+			r = httpRange{start: start, length: end - start + 1}
+		}
+
+		ranges = append(ranges, r)
+		total += r.length
+	}
+
+	if len(ranges) == 0 {
+		// A header with no ranges at all is invalid, and ignored.
+		return nil, !sawSpec
+	}
+	if total > size {
+		return nil, true
+	}
+	return ranges, true
+}
+
+// multipartRanges returns a ByteBuf containing the body of a
+// multipart/byteranges response with the given ranges of b.
+func multipartRanges(b ByteBuf, ranges []httpRange, boundary, ctype string) ByteBuf {
+	var body ByteBuf = Empty()
+	for i, r := range ranges {
+		var header bytes.Buffer
+		if i > 0 {
+			header.WriteString("\r\n")
+		}
+		fmt.Fprintf(&header, "--%s\r\n", boundary)
+		fmt.Fprintf(&header, "Content-Range: %s\r\n", r.contentRange(b.Length()))
+		fmt.Fprintf(&header, "Content-Type: %s\r\n\r\n", ctype)
+
+		body = Append(body, NewFromSlice(header.Bytes()))
+		body = Append(body, b.Section(r.start, r.length))
+	}
+	return Append(body, NewFromString("\r\n--"+boundary+"--\r\n"))
+}
+
+// shouldHijack returns whether the response to the request should be written
+// directly to the underlying connection.
+func shouldHijack(req *http.Request, body ByteBuf) bool {
+	if req.ProtoMajor != 1 || req.TLS != nil {
+		return false
+	}
+
+	// Only large amounts of data that isn't already in memory benefit
+	// from being written directly to the connection.
+	var size int64
+	walkBufs(body, func(buf ByteBuf) {
+		if !inMemory(buf) {
+			size += buf.Length()
+		}
+	})
+	return size >= hijackThreshold
+}
+
+// walkBufs calls fn with each of the buffers that b is made up of.
+func walkBufs(b ByteBuf, fn func(buf ByteBuf)) {
+	if c, ok := b.(*combinedBuf); ok {
+		for _, buf := range c.bufs {
+			fn(buf)
+		}
+		return
+	}
+	fn(b)
+}
+
+// hijack takes over the connection for the provided ResponseWriter, and writes
+// the status line and headers for a response to req with the given code. The
+// returned connection must be closed after writing the response body.
+func hijack(w http.ResponseWriter, req *http.Request, code int) (net.Conn, bool) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, false
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, false
+	}
+
+	h := w.Header().Clone()
+	h.Set("Connection", "close")
+	if h.Get("Date") == "" {
+		h.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+
+	fmt.Fprintf(brw, "%s %03d %s\r\n", req.Proto, code, http.StatusText(code))
+	h.Write(brw)
+	brw.WriteString("\r\n")
+	if err := brw.Flush(); err != nil {
+		conn.Close()
+		return nil, false
+	}
+	return conn, true
+}
+
+// logf logs an error while serving req to the server's ErrorLog, or the
+// standard logger if it doesn't have one, as the http package does.
+func logf(req *http.Request, format string, args ...interface{}) {
+	if srv, ok := req.Context().Value(http.ServerContextKey).(*http.Server); ok && srv.ErrorLog != nil {
+		srv.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// etagMatches returns whether the provided list of entity tags (from an
+// If-Match, If-None-Match or If-Range header) matches etag, using the strong
+// or weak comparison function from RFC 7232.
+func etagMatches(list, etag string, strong bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = textproto.TrimString(candidate)
+		if strong {
+			if !strings.HasPrefix(candidate, "W/") && !strings.HasPrefix(etag, "W/") && candidate == etag {
+				return true
+			}
+		} else if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,248 @@
+package bytebuf
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveRequest(b ByteBuf, method string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/", nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	w := httptest.NewRecorder()
+	ServeByteBuf(w, req, b)
+	return w
+}
+
+func TestServeByteBuf(t *testing.T) {
+	const data = "hello world, this is some data"
+	sum := sha256.Sum256([]byte(data))
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	buf := NewFromString(data)
+	defer buf.Close()
+
+	tests := []struct {
+		Name         string
+		Method       string
+		Headers      map[string]string
+		Code         int
+		Body         string
+		ContentRange string
+	}{
+		{"Full", "GET", nil, 200, data, ""},
+		{"Head", "HEAD", nil, 200, "", ""},
+		{"Range", "GET", map[string]string{"Range": "bytes=6-10"}, 206, "world", "bytes 6-10/30"},
+		{"OpenRange", "GET", map[string]string{"Range": "bytes=26-"}, 206, "data", "bytes 26-29/30"},
+		{"SuffixRange", "GET", map[string]string{"Range": "bytes=-4"}, 206, "data", "bytes 26-29/30"},
+		{"ClampedRange", "GET", map[string]string{"Range": "bytes=26-100"}, 206, "data", "bytes 26-29/30"},
+		{"HeadRange", "HEAD", map[string]string{"Range": "bytes=6-10"}, 206, "", "bytes 6-10/30"},
+		{
+			"Unsatisfiable", "GET", map[string]string{"Range": "bytes=30-40"},
+			416, "416 requested range not satisfiable\n", "bytes */30",
+		},
+		{"InvalidRange", "GET", map[string]string{"Range": "bytes=10-5"}, 200, data, ""},
+		{"OtherUnit", "GET", map[string]string{"Range": "lines=1-2"}, 200, data, ""},
+		{"OverlappingRanges", "GET", map[string]string{"Range": "bytes=0-,0-,0-"}, 200, data, ""},
+		{"IfNoneMatch", "GET", map[string]string{"If-None-Match": etag}, 304, "", ""},
+		{"IfNoneMatchWeak", "GET", map[string]string{"If-None-Match": `"foo", W/` + etag}, 304, "", ""},
+		{"IfNoneMatchStar", "GET", map[string]string{"If-None-Match": "*"}, 304, "", ""},
+		{"IfNoneMatchMismatch", "GET", map[string]string{"If-None-Match": `"foo"`}, 200, data, ""},
+		{"IfMatch", "GET", map[string]string{"If-Match": etag}, 200, data, ""},
+		{"IfMatchMismatch", "GET", map[string]string{"If-Match": `"foo"`}, 412, "", ""},
+		{"IfRange", "GET", map[string]string{"Range": "bytes=0-4", "If-Range": etag}, 206, "hello", "bytes 0-4/30"},
+		{"IfRangeWeak", "GET", map[string]string{"Range": "bytes=0-4", "If-Range": "W/" + etag}, 200, data, ""},
+		{"IfRangeMismatch", "GET", map[string]string{"Range": "bytes=0-4", "If-Range": `"foo"`}, 200, data, ""},
+		{
+			"IfRangeDate", "GET",
+			map[string]string{"Range": "bytes=0-4", "If-Range": "Mon, 02 Jan 2006 15:04:05 GMT"},
+			200, data, "",
+		},
+		{"Post", "POST", nil, 405, "405 method not allowed\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			w := serveRequest(buf, tt.Method, tt.Headers)
+			assert.Equal(t, tt.Code, w.Code)
+			assert.Equal(t, tt.Body, w.Body.String())
+			assert.Equal(t, tt.ContentRange, w.Header().Get("Content-Range"))
+
+			if tt.Code == 200 || tt.Code == 206 {
+				assert.Equal(t, etag, w.Header().Get("Etag"))
+				assert.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+				assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+				if tt.Method == "GET" {
+					assert.Equal(t, strconv.Itoa(len(tt.Body)), w.Header().Get("Content-Length"))
+				}
+			}
+		})
+	}
+
+	// The digest used for the ETag is cached.
+	_, cached := digestCacheFor(buf).get(SHA256)
+	assert.True(t, cached)
+}
+
+func TestServeByteBufHeaders(t *testing.T) {
+	buf := NewFromString("some data")
+	defer buf.Close()
+
+	// Existing headers are used instead of being computed.
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", `"custom"`)
+	w := httptest.NewRecorder()
+	w.Header().Set("Etag", `"custom"`)
+	w.Header().Set("Content-Type", "application/x-custom")
+	ServeByteBuf(w, req, buf)
+	assert.Equal(t, 304, w.Code)
+	assert.Equal(t, `"custom"`, w.Header().Get("Etag"))
+	_, cached := digestCacheFor(buf).get(SHA256)
+	assert.False(t, cached)
+
+	w = httptest.NewRecorder()
+	w.Header().Set("Content-Type", "application/x-custom")
+	ServeByteBuf(w, httptest.NewRequest("GET", "/", nil), buf)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/x-custom", w.Header().Get("Content-Type"))
+}
+
+func TestServeByteBufMultipart(t *testing.T) {
+	const data = "hello world, this is some data"
+
+	file, err := NewFromFile(makeTempFile(t, data[10:]))
+	require.NoError(t, err)
+	buf := Append(NewFromString(data[:10]), file)
+	defer buf.Close()
+
+	w := serveRequest(buf, "GET", map[string]string{"Range": "bytes=0-4, 6-10,-4"})
+	assert.Equal(t, 206, w.Code)
+	assert.Equal(t, strconv.Itoa(w.Body.Len()), w.Header().Get("Content-Length"))
+
+	mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/byteranges", mediaType)
+
+	expected := []struct {
+		ContentRange string
+		Body         string
+	}{
+		{"bytes 0-4/30", "hello"},
+		{"bytes 6-10/30", "world"},
+		{"bytes 26-29/30", "data"},
+	}
+
+	mr := multipart.NewReader(w.Body, params["boundary"])
+	for _, exp := range expected {
+		part, err := mr.NextPart()
+		require.NoError(t, err)
+		assert.Equal(t, exp.ContentRange, part.Header.Get("Content-Range"))
+		assert.Equal(t, "text/plain; charset=utf-8", part.Header.Get("Content-Type"))
+
+		body, err := ioutil.ReadAll(part)
+		require.NoError(t, err)
+		assert.Equal(t, exp.Body, string(body))
+	}
+	_, err = mr.NextPart()
+	assert.Error(t, err)
+}
+
+func TestServeByteBufHijack(t *testing.T) {
+	defer func(old int64) { hijackThreshold = old }(hijackThreshold)
+	hijackThreshold = 10
+
+	data := strings.Repeat("0123456789", 1000)
+	buf, err := NewFromFile(makeTempFile(t, data))
+	require.NoError(t, err)
+	defer buf.Close()
+
+	srv := httptest.NewServer(HandlerWithOptions(buf, ServeOptions{Hijack: true}))
+	defer srv.Close()
+
+	get := func(t *testing.T, url, rangeHeader string) (*http.Response, string) {
+		req, err := http.NewRequest("GET", url, nil)
+		require.NoError(t, err)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+
+		resp, err := srv.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(body)
+	}
+
+	t.Run("Full", func(t *testing.T) {
+		resp, body := get(t, srv.URL, "")
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.EqualValues(t, len(data), resp.ContentLength)
+		assert.True(t, resp.Close, "connection should be closed")
+		assert.Equal(t, data, body)
+	})
+
+	t.Run("Range", func(t *testing.T) {
+		resp, body := get(t, srv.URL, "bytes=95-104")
+		assert.Equal(t, 206, resp.StatusCode)
+		assert.Equal(t, "bytes 95-104/10000", resp.Header.Get("Content-Range"))
+		assert.True(t, resp.Close, "connection should be closed")
+		assert.Equal(t, data[95:105], body)
+	})
+
+	t.Run("Small", func(t *testing.T) {
+		// Responses smaller than the threshold aren't hijacked.
+		resp, body := get(t, srv.URL, "bytes=0-4")
+		assert.Equal(t, 206, resp.StatusCode)
+		assert.False(t, resp.Close, "connection shouldn't be closed")
+		assert.Equal(t, data[:5], body)
+	})
+
+	t.Run("HTTP10", func(t *testing.T) {
+		// The status line uses the request's protocol version.
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+
+		_, err = io.WriteString(conn, "GET / HTTP/1.0\r\nHost: example.com\r\n\r\n")
+		require.NoError(t, err)
+
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, "HTTP/1.0", resp.Proto)
+		assert.Equal(t, 200, resp.StatusCode)
+
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, data, string(body))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		// Connections aren't hijacked by default.
+		srv := httptest.NewServer(Handler(buf))
+		defer srv.Close()
+
+		resp, body := get(t, srv.URL, "")
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.False(t, resp.Close, "connection shouldn't be closed")
+		assert.Equal(t, data, body)
+	})
+}
@@ -0,0 +1,22 @@
+// +build !linux,!darwin
+
+package bytebuf
+
+import (
+	"errors"
+	"os"
+)
+
+var errMmapUnsupported = errors.New("bytebuf: mmap is not supported")
+
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	return nil, errMmapUnsupported
+}
+
+func munmap(data []byte) error {
+	return nil
+}
+
+func madvise(data []byte, advice MmapAdvice) error {
+	return nil
+}
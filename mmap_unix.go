@@ -0,0 +1,55 @@
+// +build linux darwin
+
+package bytebuf
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+var errMmapUnsupported = errors.New("bytebuf: mmap is not supported")
+
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	// Use the RawConn rather than f.Fd(), since the latter will put the
+	// file into blocking mode.
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		data []byte
+		merr error
+	)
+	err = conn.Control(func(fd uintptr) {
+		data, merr = unix.Mmap(int(fd), 0, size, unix.PROT_READ, unix.MAP_SHARED)
+	})
+	if err == nil {
+		err = merr
+	}
+	return data, err
+}
+
+func munmap(data []byte) error {
+	return unix.Munmap(data)
+}
+
+func madvise(data []byte, advice MmapAdvice) error {
+	var flag int
+	switch advice {
+	case MmapNormal:
+		flag = unix.MADV_NORMAL
+	case MmapSequential:
+		flag = unix.MADV_SEQUENTIAL
+	case MmapRandom:
+		flag = unix.MADV_RANDOM
+	case MmapWillNeed:
+		flag = unix.MADV_WILLNEED
+	default:
+		return nil
+	}
+
+	return unix.Madvise(data, flag)
+}
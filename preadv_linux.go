@@ -0,0 +1,65 @@
+// +build linux
+
+package bytebuf
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// preadv fills all of bufs from the file at the given offset using preadv(2).
+func preadv(f *os.File, bufs [][]byte, off int64) (int, error) {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		copied int
+		batch  [][]byte
+	)
+	for len(bufs) > 0 {
+		// Read up to maxIovecs slices at a time, skipping any empty
+		// ones; otherwise, a batch of empty slices would read nothing
+		// and look like the end of the file.
+		batch = batch[:0]
+		for _, buf := range bufs {
+			if len(batch) == maxIovecs {
+				break
+			}
+			if len(buf) > 0 {
+				batch = append(batch, buf)
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		var (
+			n    int
+			rerr error
+		)
+		err = conn.Read(func(fd uintptr) bool {
+			n, rerr = unix.Preadv(int(fd), batch, off)
+			return rerr != unix.EINTR
+		})
+		if err == nil {
+			err = rerr
+		}
+		if err != nil {
+			return copied, os.NewSyscallError("preadv", err)
+		}
+		if n == 0 {
+			return copied, io.EOF
+		}
+
+		// The read may have been short; skip past everything that
+		// was read and continue with the rest.
+		copied += n
+		off += int64(n)
+		_, bufs = splitBufs(bufs, int64(n))
+	}
+	return copied, nil
+}
@@ -0,0 +1,26 @@
+// +build !linux
+
+package bytebuf
+
+import (
+	"io"
+	"os"
+)
+
+// preadv fills all of bufs from the file at the given offset.
+func preadv(f *os.File, bufs [][]byte, off int64) (int, error) {
+	var copied int
+	for _, buf := range bufs {
+		n, err := f.ReadAt(buf, off)
+		copied += n
+		off += int64(n)
+
+		if err == io.EOF && n == len(buf) {
+			err = nil
+		}
+		if err != nil {
+			return copied, err
+		}
+	}
+	return copied, nil
+}
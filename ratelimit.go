@@ -0,0 +1,116 @@
+package bytebuf
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TokenBucket is a rate limiter for writes, which allows rate bytes per second
+// on average, with bursts of up to burst bytes. It's safe for concurrent use,
+// so a single TokenBucket can be shared between many writes (e.g. to limit
+// the total bandwidth used by a tenant); see WriteToOptions.
+type TokenBucket struct {
+	rate  float64
+	burst int64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a TokenBucket that allows rate bytes per second, with
+// bursts of up to burst bytes. The bucket starts full. It panics if rate or
+// burst isn't positive.
+func NewTokenBucket(rate, burst int64) *TokenBucket {
+	if rate <= 0 || burst <= 0 {
+		panic("bytebuf: TokenBucket rate and burst must be positive")
+	}
+	return &TokenBucket{
+		rate:   float64(rate),
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Rate returns the number of bytes per second that the bucket allows.
+func (tb *TokenBucket) Rate() int64 {
+	return int64(tb.rate)
+}
+
+// Burst returns the maximum number of bytes that the bucket allows at once.
+func (tb *TokenBucket) Burst() int64 {
+	return tb.burst
+}
+
+// Wait blocks until n bytes may be written, or until ctx is cancelled, in which
+// case it returns ctx.Err(). Waiters are served in the order that they call
+// Wait. n is clamped to the bucket's burst size.
+func (tb *TokenBucket) Wait(ctx context.Context, n int64) error {
+	if n > tb.burst {
+		n = tb.burst
+	}
+
+	// Take the tokens now, even if that leaves the bucket in debt, and then
+	// wait until the debt has been repaid; this means that later waiters
+	// wait behind earlier ones.
+	delay := tb.reserve(n)
+	if delay <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		tb.refund(n)
+		return ctx.Err()
+	}
+}
+
+// reserve takes n tokens from the bucket, and returns how long the caller
+// must wait before the tokens are available.
+func (tb *TokenBucket) reserve(n int64) time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := time.Now()
+	tb.advance(now)
+
+	tb.tokens -= float64(n)
+	if tb.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+}
+
+// refund returns n unused tokens to the bucket.
+func (tb *TokenBucket) refund(n int64) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.advance(time.Now())
+	tb.tokens += float64(n)
+	if tb.tokens > float64(tb.burst) {
+		tb.tokens = float64(tb.burst)
+	}
+}
+
+// advance adds the tokens accumulated since the last update. tb.mu must be
+// held.
+func (tb *TokenBucket) advance(now time.Time) {
+	elapsed := now.Sub(tb.last)
+	if elapsed <= 0 {
+		return
+	}
+	tb.last = now
+
+	tb.tokens += elapsed.Seconds() * tb.rate
+	if tb.tokens > float64(tb.burst) {
+		tb.tokens = float64(tb.burst)
+	}
+}
@@ -0,0 +1,49 @@
+package bytebuf
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket(t *testing.T) {
+	tb := NewTokenBucket(1000, 100)
+	assert.EqualValues(t, 1000, tb.Rate())
+	assert.EqualValues(t, 100, tb.Burst())
+
+	// The bucket starts full.
+	start := time.Now()
+	require.NoError(t, tb.Wait(context.Background(), 100))
+	assert.True(t, time.Since(start) < 50*time.Millisecond)
+
+	// Requests larger than the burst size are clamped, and then wait for
+	// the bucket to refill.
+	start = time.Now()
+	require.NoError(t, tb.Wait(context.Background(), 1000))
+	elapsed := time.Since(start)
+	assert.True(t, elapsed >= 90*time.Millisecond, "elapsed: %v", elapsed)
+}
+
+func TestTokenBucketCancel(t *testing.T) {
+	tb := NewTokenBucket(100, 100)
+	require.NoError(t, tb.Wait(context.Background(), 100))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, tb.Wait(ctx, 100))
+
+	// The cancelled wait's tokens were returned, so the bucket isn't
+	// further in debt.
+	tb.mu.Lock()
+	tokens := tb.tokens
+	tb.mu.Unlock()
+	assert.True(t, tokens > -1 && tokens < 10, "tokens: %v", tokens)
+}
+
+func TestTokenBucketInvalid(t *testing.T) {
+	assert.Panics(t, func() { NewTokenBucket(0, 100) })
+	assert.Panics(t, func() { NewTokenBucket(100, 0) })
+}
@@ -0,0 +1,116 @@
+package bytebuf
+
+import (
+	"io"
+)
+
+// ReadAtv reads len(bufs[0]) + len(bufs[1]) + ... bytes from b starting at
+// offset off, filling each slice in bufs in turn; i.e. it scatters a single
+// range of b into several slices. It otherwise behaves like io.ReaderAt,
+// returning the number of bytes read and a non-nil error if that's less than
+// the total length of bufs.
+//
+// For file-backed buffers, this reads all the slices with a single call to
+// preadv(2) where supported; in-memory buffers are copied directly.
+func ReadAtv(b ByteBuf, bufs [][]byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+
+	total := int64(0)
+	for _, buf := range bufs {
+		total += int64(len(buf))
+	}
+
+	// Limit the read to the data in the buffer.
+	want := total
+	if remaining := b.Length() - off; want > remaining {
+		want = remaining
+	}
+	if want < 0 {
+		want = 0
+	}
+
+	var (
+		n   int
+		err error
+	)
+	if want > 0 {
+		n, err = readAtv(b, truncateBufs(bufs, want), off)
+	}
+	if err == nil && int64(n) < total {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// readAtv fills all of bufs from b at the given offset, which must all be
+// within the bounds of b.
+func readAtv(b ByteBuf, bufs [][]byte, off int64) (int, error) {
+	switch v := b.(type) {
+	case *fileBuf:
+		if v.m == nil {
+			return preadv(v.f, bufs, v.off+off)
+		}
+
+	case *combinedBuf:
+		// Split the slices between the underlying buffers, so that
+		// each buffer can use its own implementation.
+		var copied int
+		for i := v.find(off); i < len(v.bufs) && len(bufs) > 0; i++ {
+			var curr [][]byte
+			curr, bufs = splitBufs(bufs, v.offsets[i+1]-off)
+
+			n, err := readAtv(v.bufs[i], curr, off-v.offsets[i])
+			copied += n
+			off += int64(n)
+			if err != nil {
+				return copied, err
+			}
+		}
+		return copied, nil
+	}
+
+	// Otherwise, read into each slice in turn.
+	var copied int
+	for _, buf := range bufs {
+		n, err := b.ReadAt(buf, off)
+		copied += n
+		off += int64(n)
+
+		if err == io.EOF && n == len(buf) {
+			err = nil
+		}
+		if err != nil {
+			return copied, err
+		}
+	}
+	return copied, nil
+}
+
+// truncateBufs returns the prefix of bufs that contains n bytes, truncating
+// the final slice if necessary.
+func truncateBufs(bufs [][]byte, n int64) [][]byte {
+	head, _ := splitBufs(bufs, n)
+	return head
+}
+
+// splitBufs splits bufs into two lists of slices, the first of which contains
+// the first n bytes and the second of which contains the remainder; a slice
+// may be split between the two.
+func splitBufs(bufs [][]byte, n int64) (head, tail [][]byte) {
+	for i, buf := range bufs {
+		if int64(len(buf)) < n {
+			n -= int64(len(buf))
+			continue
+		}
+
+		head = append(bufs[:i:i], buf[:n])
+		tail = bufs[i+1:]
+		if int64(len(buf)) > n {
+			tail = append([][]byte{buf[n:]}, tail...)
+		}
+		return head, tail
+	}
+	return bufs, nil
+}
@@ -0,0 +1,118 @@
+package bytebuf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAtv(t *testing.T) {
+	const expected = `foobarbazasdfqwer`
+
+	layouts := [][]int{
+		{1},
+		{3, 4},
+		{1, 0, 2, 5},
+		{len(expected)},
+		{4, 4, 4, 4, 1},
+	}
+
+	for _, impl := range byteBufImpls(t, expected) {
+		buf := impl.Buf
+		t.Run(impl.Name, func(t *testing.T) {
+			for _, layout := range layouts {
+				for off := 0; off < len(expected); off++ {
+					bufs, total := makeBufs(layout)
+					n, err := ReadAtv(buf, bufs, int64(off))
+
+					want := expected[off:]
+					if len(want) > total {
+						want = want[:total]
+					}
+
+					assert.Equal(t, len(want), n, "layout=%v off=%d", layout, off)
+					if len(want) < total {
+						assert.Equal(t, io.EOF, err)
+					} else {
+						assert.NoError(t, err)
+					}
+					assert.Equal(t, want, string(bytes.Join(bufs, nil)[:n]))
+				}
+			}
+
+			// Reading past the end should return io.EOF.
+			bufs, _ := makeBufs([]int{2, 2})
+			n, err := ReadAtv(buf, bufs, int64(len(expected)+1))
+			assert.Equal(t, 0, n)
+			assert.Equal(t, io.EOF, err)
+
+			// Reading nothing isn't an error.
+			for _, bufs := range [][][]byte{nil, {{}}, {{}, {}}} {
+				n, err := ReadAtv(buf, bufs, 0)
+				assert.Equal(t, 0, n)
+				assert.NoError(t, err, "bufs=%v", bufs)
+			}
+		})
+	}
+}
+
+func TestReadAtvManySlices(t *testing.T) {
+	var expected strings.Builder
+	for i := 0; i < 3000; i++ {
+		fmt.Fprintf(&expected, "%d,", i)
+	}
+
+	buf, err := NewFromFile(makeTempFile(t, expected.String()))
+	require.NoError(t, err)
+	defer buf.Close()
+
+	// Use more slices than fit in a single preadv(2) call.
+	layout := make([]int, 2000)
+	for i := range layout {
+		layout[i] = i % 5
+	}
+	bufs, total := makeBufs(layout)
+
+	n, err := ReadAtv(buf, bufs, 10)
+	require.NoError(t, err)
+	assert.Equal(t, total, n)
+	assert.Equal(t, expected.String()[10:10+total], string(bytes.Join(bufs, nil)))
+}
+
+func TestReadAtvManyEmptySlices(t *testing.T) {
+	const expected = "foobarbaz"
+
+	buf, err := NewFromFile(makeTempFile(t, expected))
+	require.NoError(t, err)
+	defer buf.Close()
+
+	// More empty slices than fit in a single preadv(2) call, followed by
+	// the slices that are actually read into.
+	layout := make([]int, 2000)
+	layout = append(layout, 3, 0, 3)
+	bufs, total := makeBufs(layout)
+
+	n, err := ReadAtv(buf, bufs, 3)
+	require.NoError(t, err)
+	assert.Equal(t, total, n)
+	assert.Equal(t, expected[3:], string(bytes.Join(bufs, nil)))
+}
+
+// makeBufs creates slices with the given lengths, and returns their total
+// length.
+func makeBufs(layout []int) ([][]byte, int) {
+	var (
+		bufs  [][]byte
+		total int
+	)
+	for _, l := range layout {
+		bufs = append(bufs, make([]byte, l))
+		total += l
+	}
+	return bufs, total
+}
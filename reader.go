@@ -0,0 +1,155 @@
+package bytebuf
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	errInvalidWhence    = errors.New("bytebuf: invalid whence")
+	errNegativePosition = errors.New("bytebuf: negative position")
+	errUnreadByte       = errors.New("bytebuf: at beginning of buffer")
+)
+
+// readByteBufSize is the amount of data that a Reader reads ahead for
+// ReadByte.
+const readByteBufSize = 4096
+
+// Reader implements the io.Reader, io.ReaderAt, io.WriterTo, io.Seeker and
+// io.ByteScanner interfaces by reading from a ByteBuf. It's returned by the
+// AsReader method of every ByteBuf, and is only valid so long as the ByteBuf
+// has not been closed.
+//
+// Unlike a ByteBuf, a Reader has a current offset, and so isn't safe for
+// concurrent use.
+type Reader struct {
+	b ByteBuf
+	i int64
+
+	// buf contains the data starting at bufOff, which is read ahead of
+	// time by ReadByte; since a ByteBuf is read-only, it never needs to be
+	// invalidated.
+	buf    []byte
+	bufOff int64
+}
+
+var (
+	_ io.ReadSeeker  = (*Reader)(nil)
+	_ io.ReaderAt    = (*Reader)(nil)
+	_ io.WriterTo    = (*Reader)(nil)
+	_ io.ByteScanner = (*Reader)(nil)
+)
+
+// NewReader returns a Reader that reads from b, starting at the beginning.
+// It doesn't take ownership of b.
+func NewReader(b ByteBuf) *Reader {
+	return &Reader{b: b}
+}
+
+// Len returns the number of bytes remaining to be read.
+func (r *Reader) Len() int64 {
+	if r.i >= r.b.Length() {
+		return 0
+	}
+	return r.b.Length() - r.i
+}
+
+// Size returns the length of the underlying ByteBuf. It's unaffected by any
+// method calls.
+func (r *Reader) Size() int64 {
+	return r.b.Length()
+}
+
+// Read implements io.Reader
+func (r *Reader) Read(p []byte) (int, error) {
+	remaining := r.Len()
+	if remaining == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	n, err := r.b.ReadAt(p, r.i)
+	r.i += int64(n)
+	if n == len(p) {
+		// ReaderAt implementations may return io.EOF along with the
+		// final bytes, but we'll return it on the next call instead.
+		err = nil
+	}
+	return n, err
+}
+
+// ReadAt implements io.ReaderAt; it's unaffected by, and doesn't modify, the
+// current offset.
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	return r.b.ReadAt(p, off)
+}
+
+// ReadByte implements io.ByteReader
+func (r *Reader) ReadByte() (byte, error) {
+	if r.Len() == 0 {
+		return 0, io.EOF
+	}
+
+	// Callers of ReadByte usually read a byte at a time, which would
+	// otherwise be a system call per byte for some buffers.
+	if r.i < r.bufOff || r.i >= r.bufOff+int64(len(r.buf)) {
+		if r.buf == nil {
+			r.buf = make([]byte, readByteBufSize)
+		}
+
+		n, err := r.b.ReadAt(r.buf[:cap(r.buf)], r.i)
+		if n == 0 {
+			return 0, err
+		}
+		r.buf = r.buf[:n]
+		r.bufOff = r.i
+	}
+
+	c := r.buf[r.i-r.bufOff]
+	r.i++
+	return c, nil
+}
+
+// UnreadByte implements io.ByteScanner
+func (r *Reader) UnreadByte() error {
+	if r.i <= 0 {
+		return errUnreadByte
+	}
+	r.i--
+	return nil
+}
+
+// Seek implements io.Seeker
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.i + offset
+	case io.SeekEnd:
+		abs = r.b.Length() + offset
+	default:
+		return 0, errInvalidWhence
+	}
+	if abs < 0 {
+		return 0, errNegativePosition
+	}
+	r.i = abs
+	return abs, nil
+}
+
+// WriteTo implements io.WriterTo. It writes the remaining data with the
+// WriteTo method of the underlying ByteBuf, so that any optimized
+// implementations (e.g. sendfile or writev) are used.
+func (r *Reader) WriteTo(w io.Writer) (n int64, err error) {
+	if r.Len() == 0 {
+		return 0, nil
+	}
+
+	n, err = WriteToFrom(r.b, w, r.i)
+	r.i += n
+	return n, err
+}
@@ -0,0 +1,154 @@
+package bytebuf
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaderSeek(t *testing.T) {
+	r := NewFromString("hello world").AsReader()
+
+	tests := []struct {
+		Offset   int64
+		Whence   int
+		Expected int64
+		Err      error
+	}{
+		{6, io.SeekStart, 6, nil},
+		{-1, io.SeekCurrent, 5, nil},
+		{-5, io.SeekEnd, 6, nil},
+		{100, io.SeekStart, 100, nil},
+		{-1, io.SeekStart, 0, errNegativePosition},
+		{0, 42, 0, errInvalidWhence},
+	}
+	for _, tt := range tests {
+		pos, err := r.Seek(tt.Offset, tt.Whence)
+		if tt.Err != nil {
+			assert.Equal(t, tt.Err, err)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, tt.Expected, pos)
+	}
+
+	// Reading past the end returns EOF.
+	_, err := r.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+	_, err = r.ReadByte()
+	assert.Equal(t, io.EOF, err)
+	assert.EqualValues(t, 0, r.Len())
+
+	n, err := r.WriteTo(ioutil.Discard)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, n)
+
+	// The reader can be rewound.
+	_, err = r.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+}
+
+func TestReaderUnreadByte(t *testing.T) {
+	r := NewFromString("ab").AsReader()
+	assert.Equal(t, errUnreadByte, r.UnreadByte())
+
+	c, err := r.ReadByte()
+	require.NoError(t, err)
+	assert.Equal(t, byte('a'), c)
+
+	require.NoError(t, r.UnreadByte())
+	c, err = r.ReadByte()
+	require.NoError(t, err)
+	assert.Equal(t, byte('a'), c)
+
+	// Reads see the effect of UnreadByte.
+	require.NoError(t, r.UnreadByte())
+	p := make([]byte, 2)
+	n, err := r.Read(p)
+	require.NoError(t, err)
+	assert.Equal(t, "ab", string(p[:n]))
+}
+
+func TestReaderReadByteLarge(t *testing.T) {
+	// ReadByte across several read-ahead buffers, mixed with other reads.
+	expected := strings.Repeat("0123456789abcdef", 3*readByteBufSize/16+3)
+	file, err := NewFromFile(makeTempFile(t, expected))
+	require.NoError(t, err)
+	buf := Append(NewFromString(expected[:100]), file)
+	defer buf.Close()
+	expected = expected[:100] + expected
+
+	r := buf.AsReader()
+	var got bytes.Buffer
+	for i := 0; ; i++ {
+		if i%1000 == 999 {
+			p := make([]byte, 77)
+			n, err := r.Read(p)
+			got.Write(p[:n])
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			continue
+		}
+
+		c, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		got.WriteByte(c)
+	}
+	assert.Equal(t, expected, got.String())
+}
+
+// writeToCountingBuf is a ByteBuf that counts calls to WriteTo on itself and
+// any sections of it.
+type writeToCountingBuf struct {
+	ByteBuf
+	calls *int
+}
+
+func (b writeToCountingBuf) WriteTo(w io.Writer) (int64, error) {
+	*b.calls++
+	return b.ByteBuf.WriteTo(w)
+}
+
+func (b writeToCountingBuf) Section(off, n int64) ByteBuf {
+	return writeToCountingBuf{b.ByteBuf.Section(off, n), b.calls}
+}
+
+func TestReaderWriteTo(t *testing.T) {
+	var calls int
+	buf := writeToCountingBuf{NewFromSlices([]byte("foo"), []byte("bar"), []byte("baz")), &calls}
+	defer buf.Close()
+
+	// Copying from a Reader uses the ByteBuf's own WriteTo, both from the
+	// start and after seeking.
+	var out bytes.Buffer
+	n, err := io.Copy(&out, NewReader(buf))
+	require.NoError(t, err)
+	assert.EqualValues(t, 9, n)
+	assert.Equal(t, "foobarbaz", out.String())
+	assert.Equal(t, 1, calls)
+
+	r := NewReader(buf)
+	_, err = r.Seek(2, io.SeekStart)
+	require.NoError(t, err)
+
+	out.Reset()
+	n, err = io.Copy(&out, r)
+	require.NoError(t, err)
+	assert.EqualValues(t, 7, n)
+	assert.Equal(t, "obarbaz", out.String())
+	assert.Equal(t, 2, calls)
+	assert.EqualValues(t, 0, r.Len())
+}
@@ -0,0 +1,75 @@
+package bytebuf
+
+import (
+	"sync/atomic"
+)
+
+// Retain returns a new handle to the data in b. The returned ByteBuf and b
+// can be used and closed independently of each other, and any underlying
+// resources (e.g. open files) are only released once b and all handles
+// returned from Retain or Section have been closed.
+//
+// This can be used to share a buffer between multiple owners; for example, a
+// common header can be passed to multiple calls to Append as:
+//
+//     one := Append(Retain(header), body1)
+//     two := Append(Retain(header), body2)
+//     header.Close()
+func Retain(b ByteBuf) ByteBuf {
+	return b.Section(0, b.Length())
+}
+
+// refCount counts the number of open handles to a shared resource, and
+// releases the resource once the last handle has been closed.
+type refCount struct {
+	refs    int32
+	release func() error
+}
+
+// newRefCount creates a refCount with a single reference that calls the
+// provided function once all references have been released.
+func newRefCount(release func() error) *refCount {
+	return &refCount{refs: 1, release: release}
+}
+
+// retain adds a reference.
+func (r *refCount) retain() {
+	atomic.AddInt32(&r.refs, 1)
+}
+
+// decRef removes a reference, releasing the resource if this was the last
+// reference and returning any error from doing so.
+func (r *refCount) decRef() error {
+	if atomic.AddInt32(&r.refs, -1) == 0 {
+		return r.release()
+	}
+	return nil
+}
+
+// handle is embedded in a ByteBuf that holds a single reference to a shared
+// resource. Closing a handle multiple times releases the reference only once.
+// The zero value is a handle with no underlying resource.
+type handle struct {
+	ref    *refCount
+	closed uint32
+}
+
+// dup returns a new handle to the same resource.
+func (h *handle) dup() handle {
+	if h.ref == nil {
+		return handle{}
+	}
+	h.ref.retain()
+	return handle{ref: h.ref}
+}
+
+// close releases this handle's reference, if it hasn't already been released.
+func (h *handle) close() error {
+	if h.ref == nil {
+		return nil
+	}
+	if !atomic.CompareAndSwapUint32(&h.closed, 0, 1) {
+		return nil
+	}
+	return h.ref.decRef()
+}
@@ -0,0 +1,126 @@
+package bytebuf
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// assertFileClosed asserts whether the given file has been closed.
+func assertFileClosed(t *testing.T, f *os.File, closed bool) {
+	_, err := f.Stat()
+	if closed {
+		assert.Error(t, err, "expected file to be closed")
+	} else {
+		assert.NoError(t, err, "expected file to be open")
+	}
+}
+
+func TestRetain(t *testing.T) {
+	const expected = `foobarbaz`
+
+	t.Run("File", func(t *testing.T) {
+		f := makeTempFile(t, expected)
+		buf, err := NewFromFile(f)
+		require.NoError(t, err)
+
+		retained := Retain(buf)
+		require.NoError(t, buf.Close())
+		assertFileClosed(t, f, false)
+
+		data, err := ReadAll(retained)
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected, string(data))
+		}
+
+		require.NoError(t, retained.Close())
+		assertFileClosed(t, f, true)
+	})
+
+	t.Run("Mmap", func(t *testing.T) {
+		f := makeTempFile(t, expected)
+		buf, err := NewFromFileMmap(f, MmapNormal)
+		require.NoError(t, err)
+
+		sec := buf.Section(3, 3)
+		require.NoError(t, buf.Close())
+
+		data, err := ReadAll(sec)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "bar", string(data))
+		}
+
+		require.NoError(t, sec.Close())
+		assertFileClosed(t, f, true)
+	})
+
+	t.Run("BytesReader", func(t *testing.T) {
+		buf := NewFromBytesReader(bytes.NewReader([]byte(expected)))
+
+		sec := buf.Section(3, 3)
+		require.NoError(t, buf.Close())
+
+		testByteBufImpl(t, Retain(sec), "bar")
+		require.NoError(t, sec.Close())
+	})
+
+	t.Run("DoubleClose", func(t *testing.T) {
+		f := makeTempFile(t, expected)
+		buf, err := NewFromFile(f)
+		require.NoError(t, err)
+
+		retained := Retain(buf)
+
+		// Closing the same handle multiple times must only release a
+		// single reference.
+		require.NoError(t, buf.Close())
+		require.NoError(t, buf.Close())
+		assertFileClosed(t, f, false)
+
+		require.NoError(t, retained.Close())
+		assertFileClosed(t, f, true)
+	})
+
+	t.Run("SharedAppend", func(t *testing.T) {
+		f := makeTempFile(t, "header")
+		header, err := NewFromFile(f)
+		require.NoError(t, err)
+
+		one := Append(Retain(header), NewFromString("one"))
+		two := Append(Retain(header), NewFromString("two"))
+		require.NoError(t, header.Close())
+
+		require.NoError(t, one.Close())
+		assertFileClosed(t, f, false)
+
+		data, err := ReadAll(two)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "headertwo", string(data))
+		}
+
+		require.NoError(t, two.Close())
+		assertFileClosed(t, f, true)
+	})
+
+	t.Run("CombinedSection", func(t *testing.T) {
+		f := makeTempFile(t, expected[3:])
+		fbuf, err := NewFromFile(f)
+		require.NoError(t, err)
+
+		combined := Append(NewFromString(expected[:3]), fbuf)
+		sec := combined.Section(1, 5)
+		require.NoError(t, combined.Close())
+		assertFileClosed(t, f, false)
+
+		data, err := ReadAll(sec)
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected[1:6], string(data))
+		}
+
+		require.NoError(t, sec.Close())
+		assertFileClosed(t, f, true)
+	})
+}
@@ -0,0 +1,235 @@
+package bytebuf
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// SplitFunc is the signature of the function used by a Scanner to split a
+// buffer into records. It's called with the buffer being scanned and the
+// offset of the data that hasn't been scanned yet, which is always less than
+// the buffer's length.
+//
+// It returns the number of bytes to advance past off, and the length of the
+// record starting at off; the record must not be longer than advance, which
+// allows the function to omit a trailing delimiter from each record. If it
+// returns an error, scanning stops and the error is returned from Scanner.Err.
+//
+// The buffer passed to the function has the same contents as the buffer
+// being scanned, but may be a wrapper around it that caches data read from
+// buffers that aren't in memory.
+type SplitFunc func(b ByteBuf, off int64) (advance, recordLen int64, err error)
+
+var errRecordTooLong = errors.New("bytebuf: SplitFunc returned record longer than advance")
+
+// Scanner splits a ByteBuf into records, similarly to bufio.Scanner. Unlike
+// bufio.Scanner, each record is a section of the underlying buffer rather than
+// a copy, and so there is no maximum record size.
+type Scanner struct {
+	b     ByteBuf
+	off   int64
+	split SplitFunc
+
+	// splitBuf is the buffer that's passed to split; see readAheadBuf.
+	splitBuf ByteBuf
+
+	record    ByteBuf
+	recordOff int64
+	err       error
+}
+
+// NewScanner returns a Scanner that splits b into lines, as with ScanLines.
+// The Scanner doesn't take ownership of b, which must remain open until
+// scanning is complete.
+func NewScanner(b ByteBuf) *Scanner {
+	s := &Scanner{
+		b:        b,
+		split:    ScanLines,
+		splitBuf: b,
+	}
+	if !inMemory(b) {
+		s.splitBuf = &readAheadBuf{ByteBuf: b}
+	}
+	return s
+}
+
+// Split sets the split function for the Scanner; it must be called before
+// Scan.
+func (s *Scanner) Split(split SplitFunc) {
+	s.split = split
+}
+
+// Scan advances the Scanner to the next record, which is then available
+// through the Record method. It returns false when there are no more records,
+// either because the end of the buffer was reached or because of an error.
+func (s *Scanner) Scan() bool {
+	if s.record != nil {
+		s.record.Close()
+		s.record = nil
+	}
+
+	remaining := s.b.Length() - s.off
+	if s.err != nil || remaining <= 0 {
+		return false
+	}
+
+	advance, recordLen, err := s.split(s.splitBuf, s.off)
+	switch {
+	case err != nil:
+		s.err = err
+	case advance < 0:
+		s.err = bufio.ErrNegativeAdvance
+	case advance == 0:
+		s.err = io.ErrNoProgress
+	case advance > remaining:
+		s.err = bufio.ErrAdvanceTooFar
+	case recordLen < 0 || recordLen > advance:
+		s.err = errRecordTooLong
+	}
+	if s.err != nil {
+		return false
+	}
+
+	s.record = s.b.Section(s.off, recordLen)
+	s.recordOff = s.off
+	s.off += advance
+	return true
+}
+
+// Record returns the most recent record found by a call to Scan. The returned
+// buffer is closed by the next call to Scan; to keep it for longer, use
+// Retain.
+func (s *Scanner) Record() ByteBuf {
+	return s.record
+}
+
+// Offset returns the offset of the most recent record within the buffer being
+// scanned.
+func (s *Scanner) Offset() int64 {
+	return s.recordOff
+}
+
+// Err returns the first error that was encountered by the Scanner.
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// ScanLines is a SplitFunc that returns each line of text, stripped of any
+// trailing end-of-line marker; this is either an optional carriage return
+// followed by a mandatory newline, or the end of the buffer.
+func ScanLines(b ByteBuf, off int64) (advance, recordLen int64, err error) {
+	idx, err := indexByteFrom(b, off, '\n')
+	if err != nil {
+		return 0, 0, err
+	}
+	if idx < 0 {
+		idx = b.Length()
+		advance = idx - off
+	} else {
+		advance = idx - off + 1
+	}
+	recordLen = idx - off
+
+	// Drop a trailing carriage return.
+	if recordLen > 0 {
+		var last [1]byte
+		if _, err := b.ReadAt(last[:], idx-1); err != nil && err != io.EOF {
+			return 0, 0, err
+		}
+		if last[0] == '\r' {
+			recordLen--
+		}
+	}
+	return advance, recordLen, nil
+}
+
+// ScanDelimiter returns a SplitFunc that returns each record separated by the
+// provided delimiter, without the delimiter itself. The final record ends at
+// the end of the buffer; if the buffer ends with the delimiter, there is no
+// empty record after it.
+func ScanDelimiter(delim []byte) SplitFunc {
+	if len(delim) == 0 {
+		panic("bytebuf: empty delimiter")
+	}
+
+	return func(b ByteBuf, off int64) (advance, recordLen int64, err error) {
+		idx, err := indexFrom(b, off, delim)
+		if err != nil {
+			return 0, 0, err
+		}
+		if idx < 0 {
+			remaining := b.Length() - off
+			return remaining, remaining, nil
+		}
+		return idx - off + int64(len(delim)), idx - off, nil
+	}
+}
+
+// scanWindowSize is the amount of data that a Scanner reads at once from
+// buffers that aren't in memory.
+const scanWindowSize = 64 * 1024
+
+// readAheadBuf is a ByteBuf that caches a window of the data in another
+// buffer. A Scanner passes one to its split function when scanning a buffer
+// that isn't in memory, since split functions usually look at only a few
+// bytes after each offset; without it, each record would need at least one
+// separate read from the underlying buffer.
+//
+// walkSegments passes data from the window to its callback directly, so a
+// readAheadBuf isn't safe for concurrent use.
+type readAheadBuf struct {
+	ByteBuf
+
+	window    []byte
+	windowOff int64
+}
+
+// fill makes sure that the window contains the data at off, reading from the
+// underlying buffer if necessary.
+func (b *readAheadBuf) fill(off int64) error {
+	if off >= b.windowOff && off < b.windowOff+int64(len(b.window)) {
+		return nil
+	}
+	if b.window == nil {
+		b.window = make([]byte, scanWindowSize)
+	}
+
+	n, err := b.ByteBuf.ReadAt(b.window[:cap(b.window)], off)
+	b.window = b.window[:n]
+	b.windowOff = off
+	if n == 0 {
+		if err == nil {
+			err = io.ErrNoProgress
+		}
+		return err
+	}
+	return nil
+}
+
+// ReadAt implements io.ReaderAt
+func (b *readAheadBuf) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+
+	copied := 0
+	for len(p) > 0 {
+		// Large reads that aren't in the window go directly to the
+		// underlying buffer.
+		inWindow := off >= b.windowOff && off < b.windowOff+int64(len(b.window))
+		if !inWindow && len(p) >= scanWindowSize {
+			n, err := b.ByteBuf.ReadAt(p, off)
+			return copied + n, err
+		}
+
+		if err := b.fill(off); err != nil {
+			return copied, err
+		}
+		n := copy(p, b.window[off-b.windowOff:])
+		copied += n
+		off += int64(n)
+		p = p[n:]
+	}
+	return copied, nil
+}
@@ -0,0 +1,198 @@
+package bytebuf
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scanAll(t *testing.T, s *Scanner) []string {
+	var records []string
+	for s.Scan() {
+		records = append(records, mustReadAll(t, s.Record()))
+	}
+	return records
+}
+
+func TestScannerLines(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	inputs := []string{
+		"",
+		"\n",
+		"foo",
+		"foo\n",
+		"foo\nbar",
+		"foo\r\nbar\r\n",
+		"foo\n\nbar\n\n",
+		"\r\n\r",
+		"a\rb\r\nc\n",
+	}
+	for _, input := range inputs {
+		var expected []string
+		bs := bufio.NewScanner(strings.NewReader(input))
+		for bs.Scan() {
+			expected = append(expected, bs.Text())
+		}
+		require.NoError(t, bs.Err())
+
+		for i := 0; i < 4; i++ {
+			buf := splitRandomly(t, rnd, []byte(input))
+
+			s := NewScanner(buf)
+			assert.Equal(t, expected, scanAll(t, s), "input: %q", input)
+			assert.NoError(t, s.Err())
+
+			buf.Close()
+		}
+	}
+}
+
+func TestScannerDelimiter(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	const input = "foo::bar:::baz::::"
+	buf := splitRandomly(t, rnd, []byte(input))
+	defer buf.Close()
+
+	s := NewScanner(buf)
+	s.Split(ScanDelimiter([]byte("::")))
+
+	var offsets []int64
+	for s.Scan() {
+		offsets = append(offsets, s.Offset())
+	}
+	assert.NoError(t, s.Err())
+	assert.Equal(t, []int64{0, 5, 10, 16}, offsets)
+
+	s = NewScanner(buf)
+	s.Split(ScanDelimiter([]byte("::")))
+	assert.Equal(t, []string{"foo", "bar", ":baz", ""}, scanAll(t, s))
+}
+
+func TestScannerLargeRecords(t *testing.T) {
+	// Records that are much larger than bufio.MaxScanTokenSize.
+	record := bytes.Repeat([]byte("x"), 4*bufio.MaxScanTokenSize)
+	input := string(record) + "\n" + string(record[1:]) + "\n"
+
+	buf, err := NewFromFile(makeTempFile(t, input))
+	require.NoError(t, err)
+	defer buf.Close()
+
+	s := NewScanner(buf)
+	require.True(t, s.Scan())
+	first := Retain(s.Record())
+	require.True(t, s.Scan())
+	assert.EqualValues(t, len(record)-1, s.Record().Length())
+	assert.False(t, s.Scan())
+	require.NoError(t, s.Err())
+
+	// The retained record is still usable.
+	assert.Equal(t, string(record), mustReadAll(t, first))
+	first.Close()
+}
+
+func TestScannerErrors(t *testing.T) {
+	buf := NewFromString("foobar")
+	defer buf.Close()
+
+	errSplit := errors.New("split failed")
+	tests := []struct {
+		Name  string
+		Split SplitFunc
+		Err   error
+	}{
+		{"Error", func(b ByteBuf, off int64) (int64, int64, error) {
+			return 0, 0, errSplit
+		}, errSplit},
+		{"NegativeAdvance", func(b ByteBuf, off int64) (int64, int64, error) {
+			return -1, 0, nil
+		}, bufio.ErrNegativeAdvance},
+		{"NoProgress", func(b ByteBuf, off int64) (int64, int64, error) {
+			return 0, 0, nil
+		}, io.ErrNoProgress},
+		{"AdvanceTooFar", func(b ByteBuf, off int64) (int64, int64, error) {
+			return 4, 4, nil
+		}, bufio.ErrAdvanceTooFar},
+		{"RecordTooLong", func(b ByteBuf, off int64) (int64, int64, error) {
+			return 1, 2, nil
+		}, errRecordTooLong},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			s := NewScanner(buf)
+			s.Split(tt.Split)
+
+			// The first record is fine, for AdvanceTooFar.
+			for s.Scan() {
+			}
+			assert.Equal(t, tt.Err, s.Err())
+			assert.False(t, s.Scan())
+		})
+	}
+}
+
+// readAtCountingBuf is a ByteBuf that counts calls to ReadAt.
+type readAtCountingBuf struct {
+	ByteBuf
+	reads int
+}
+
+func (b *readAtCountingBuf) ReadAt(p []byte, off int64) (int, error) {
+	b.reads++
+	return b.ByteBuf.ReadAt(p, off)
+}
+
+func TestScannerFileManyLines(t *testing.T) {
+	var (
+		input    strings.Builder
+		expected []string
+	)
+	for i := 0; input.Len() < 4*1024*1024; i++ {
+		line := fmt.Sprintf("line %d %s", i, strings.Repeat("x", i%70))
+		expected = append(expected, line)
+		input.WriteString(line)
+		if i%3 == 0 {
+			input.WriteString("\r")
+		}
+		input.WriteString("\n")
+	}
+
+	file, err := NewFromFile(makeTempFile(t, input.String()))
+	require.NoError(t, err)
+	defer file.Close()
+
+	t.Run("Lines", func(t *testing.T) {
+		buf := &readAtCountingBuf{ByteBuf: file}
+		s := NewScanner(buf)
+		assert.Equal(t, expected, scanAll(t, s))
+		assert.NoError(t, s.Err())
+
+		// The file is read in large chunks, not once per line.
+		assert.True(t, buf.reads < 200, "reads: %d", buf.reads)
+	})
+
+	t.Run("Delimiter", func(t *testing.T) {
+		buf := &readAtCountingBuf{ByteBuf: file}
+		s := NewScanner(buf)
+		s.Split(ScanDelimiter([]byte("\n")))
+
+		var records []string
+		for s.Scan() {
+			records = append(records, strings.TrimSuffix(mustReadAll(t, s.Record()), "\r"))
+		}
+		assert.Equal(t, expected, records)
+		assert.NoError(t, s.Err())
+		assert.True(t, buf.reads < 200, "reads: %d", buf.reads)
+	})
+}
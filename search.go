@@ -0,0 +1,317 @@
+package bytebuf
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// This file contains functions that mirror those in the bytes package. Data is
+// searched segment-by-segment (see walkSegments), so file-backed buffers are
+// searched without reading them fully into memory, and matches that span the
+// boundary between two segments are found.
+
+// Index returns the offset of the first instance of sep in b, or -1 if sep is
+// not present in b.
+func Index(b ByteBuf, sep []byte) (int64, error) {
+	if len(sep) == 0 {
+		return 0, nil
+	}
+	return indexFrom(b, 0, sep)
+}
+
+// indexFrom returns the offset of the first instance of the non-empty sep in
+// b at or after off, or -1 if there isn't one.
+func indexFrom(b ByteBuf, off int64, sep []byte) (int64, error) {
+	if len(sep) == 1 {
+		return indexByteFrom(b, off, sep[0])
+	}
+
+	idx := int64(-1)
+	err := findMatches(b, off, sep, false, func(off int64) bool {
+		idx = off
+		return false
+	})
+	if err != nil {
+		return -1, err
+	}
+	return idx, nil
+}
+
+// IndexByte returns the offset of the first instance of c in b, or -1 if c is
+// not present in b.
+func IndexByte(b ByteBuf, c byte) (int64, error) {
+	return indexByteFrom(b, 0, c)
+}
+
+// indexByteFrom returns the offset of the first instance of c in b at or after
+// off, or -1 if there isn't one.
+func indexByteFrom(b ByteBuf, off int64, c byte) (int64, error) {
+	var (
+		idx = int64(-1)
+		pos = off
+	)
+	err := walkSegments(b, off, b.Length()-off, func(p []byte) error {
+		if i := bytes.IndexByte(p, c); i >= 0 {
+			idx = pos + int64(i)
+			return errStopWalk
+		}
+		pos += int64(len(p))
+		return nil
+	})
+	if err != nil && err != errStopWalk {
+		return -1, err
+	}
+	return idx, nil
+}
+
+// LastIndex returns the offset of the last instance of sep in b, or -1 if sep
+// is not present in b.
+func LastIndex(b ByteBuf, sep []byte) (int64, error) {
+	if len(sep) == 0 {
+		return b.Length(), nil
+	}
+
+	idx := int64(-1)
+	err := findMatches(b, 0, sep, true, func(off int64) bool {
+		idx = off
+		return true
+	})
+	if err != nil {
+		return -1, err
+	}
+	return idx, nil
+}
+
+// Count counts the number of non-overlapping instances of sep in b. If sep is
+// empty, Count returns 1 + the number of UTF-8-encoded code points in b.
+func Count(b ByteBuf, sep []byte) (int64, error) {
+	var count int64
+	if len(sep) == 0 {
+		err := walkRunes(b, func(off int64, size int) {
+			count++
+		})
+		return count + 1, err
+	}
+
+	err := findMatches(b, 0, sep, false, func(off int64) bool {
+		count++
+		return true
+	})
+	return count, err
+}
+
+// Contains reports whether sep is within b.
+func Contains(b ByteBuf, sep []byte) (bool, error) {
+	idx, err := Index(b, sep)
+	return idx >= 0, err
+}
+
+// HasPrefix tests whether b begins with prefix.
+func HasPrefix(b ByteBuf, prefix []byte) (bool, error) {
+	return hasBytesAt(b, 0, prefix)
+}
+
+// HasSuffix tests whether b ends with suffix.
+func HasSuffix(b ByteBuf, suffix []byte) (bool, error) {
+	return hasBytesAt(b, b.Length()-int64(len(suffix)), suffix)
+}
+
+// hasBytesAt returns whether the data in b at the given offset is equal to
+// expected.
+func hasBytesAt(b ByteBuf, off int64, expected []byte) (bool, error) {
+	if off < 0 || off+int64(len(expected)) > b.Length() {
+		return false, nil
+	}
+
+	equal := true
+	err := walkSegments(b, off, int64(len(expected)), func(p []byte) error {
+		if !bytes.Equal(p, expected[:len(p)]) {
+			equal = false
+			return errStopWalk
+		}
+		expected = expected[len(p):]
+		return nil
+	})
+	if err != nil && err != errStopWalk {
+		return false, err
+	}
+	return equal, nil
+}
+
+// Split slices b into all sub-buffers separated by sep and returns a slice of
+// the sub-buffers between those separators. If sep is empty, Split splits
+// after each UTF-8 sequence.
+//
+// The returned buffers are sections of b (see ByteBuf.Section), so no data is
+// copied; each of them must be closed by the caller.
+func Split(b ByteBuf, sep []byte) ([]ByteBuf, error) {
+	var ret []ByteBuf
+	if len(sep) == 0 {
+		err := walkRunes(b, func(off int64, size int) {
+			ret = append(ret, b.Section(off, int64(size)))
+		})
+		if err != nil {
+			closeAll(ret)
+			return nil, err
+		}
+		return ret, nil
+	}
+
+	start := int64(0)
+	err := findMatches(b, 0, sep, false, func(off int64) bool {
+		ret = append(ret, b.Section(start, off-start))
+		start = off + int64(len(sep))
+		return true
+	})
+	if err != nil {
+		closeAll(ret)
+		return nil, err
+	}
+	return append(ret, b.Section(start, b.Length()-start)), nil
+}
+
+// closeAll closes all of the provided buffers.
+func closeAll(bufs []ByteBuf) {
+	for _, buf := range bufs {
+		buf.Close()
+	}
+}
+
+// findMatches calls fn with the offset of each instance of the non-empty sep
+// in b at or after off, in order, until fn returns false. If overlap is false, then only
+// non-overlapping instances are reported.
+//
+// Instances that span multiple segments are found by keeping a copy of the
+// last len(sep)-1 bytes of the previous segments, and searching that combined
+// with the start of the next segment.
+func findMatches(b ByteBuf, off int64, sep []byte, overlap bool, fn func(off int64) bool) error {
+	step := int64(len(sep))
+	if overlap {
+		step = 1
+	}
+
+	var (
+		keep     = len(sep) - 1
+		carry    = make([]byte, 0, keep)
+		carryOff int64
+		window   = make([]byte, 0, 2*keep)
+		pos      = off
+		next     = off
+	)
+	err := walkSegments(b, off, b.Length()-off, func(p []byte) error {
+		// Look for instances that begin in the carried-over data and
+		// end in this segment.
+		if len(carry) > 0 {
+			head := p
+			if len(head) > keep {
+				head = head[:keep]
+			}
+			window = append(append(window[:0], carry...), head...)
+
+			for i := 0; i < len(carry); {
+				j := bytes.Index(window[i:], sep)
+				if j < 0 || i+j >= len(carry) {
+					break
+				}
+
+				off := carryOff + int64(i+j)
+				if off >= next {
+					if !fn(off) {
+						return errStopWalk
+					}
+					next = off + step
+				}
+				i += j + 1
+			}
+		}
+
+		// Look for instances within this segment.
+		i := int64(0)
+		if next > pos {
+			i = next - pos
+		}
+		for i+int64(len(sep)) <= int64(len(p)) {
+			j := bytes.Index(p[i:], sep)
+			if j < 0 {
+				break
+			}
+
+			off := pos + i + int64(j)
+			if !fn(off) {
+				return errStopWalk
+			}
+			next = off + step
+			i = next - pos
+		}
+
+		// Keep the end of the data for the next segment.
+		if len(p) >= keep {
+			carry = append(carry[:0], p[len(p)-keep:]...)
+			carryOff = pos + int64(len(p)-keep)
+		} else {
+			carry = append(carry, p...)
+			if excess := len(carry) - keep; excess > 0 {
+				carry = append(carry[:0], carry[excess:]...)
+				carryOff += int64(excess)
+			}
+		}
+		pos += int64(len(p))
+		return nil
+	})
+	if err == errStopWalk {
+		err = nil
+	}
+	return err
+}
+
+// walkRunes calls fn with the offset and size of each UTF-8 sequence in b, in
+// order. As with utf8.DecodeRune, each byte of an invalid sequence is treated
+// as a separate sequence of size 1.
+func walkRunes(b ByteBuf, fn func(off int64, size int)) error {
+	var (
+		partial    = make([]byte, 0, utf8.UTFMax)
+		partialOff int64
+		pos        int64
+	)
+	err := walkSegments(b, 0, b.Length(), func(p []byte) error {
+		// Complete any sequence that was split across segments.
+		for len(partial) > 0 && len(p) > 0 {
+			partial = append(partial, p[0])
+			p = p[1:]
+			pos++
+
+			for len(partial) > 0 && utf8.FullRune(partial) {
+				_, size := utf8.DecodeRune(partial)
+				fn(partialOff, size)
+				partial = append(partial[:0], partial[size:]...)
+				partialOff += int64(size)
+			}
+		}
+
+		for i := 0; i < len(p); {
+			if !utf8.FullRune(p[i:]) {
+				partial = append(partial[:0], p[i:]...)
+				partialOff = pos + int64(i)
+				break
+			}
+
+			_, size := utf8.DecodeRune(p[i:])
+			fn(pos+int64(i), size)
+			i += size
+		}
+		pos += int64(len(p))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Any remaining data is an incomplete sequence.
+	for len(partial) > 0 {
+		_, size := utf8.DecodeRune(partial)
+		fn(partialOff, size)
+		partial = partial[size:]
+		partialOff += int64(size)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package bytebuf
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// splitRandomly returns a buffer containing data, made up of a random mix of
+// in-memory and file-backed pieces; many of the pieces are very short, so that
+// matches span multiple segments.
+func splitRandomly(t *testing.T, rnd *rand.Rand, data []byte) ByteBuf {
+	var bufs []ByteBuf
+	for len(data) > 0 {
+		n := 1 + rnd.Intn(6)
+		if n > len(data) {
+			n = len(data)
+		}
+
+		if rnd.Intn(8) == 0 {
+			buf, err := NewFromFile(makeTempFile(t, string(data[:n])))
+			require.NoError(t, err)
+			bufs = append(bufs, buf)
+		} else {
+			bufs = append(bufs, NewFromSlices(data[:n]))
+		}
+		data = data[n:]
+	}
+
+	switch len(bufs) {
+	case 0:
+		return Empty()
+	case 1:
+		return bufs[0]
+	default:
+		return newCombinedBuf(bufs)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	datas := []string{
+		"",
+		"a",
+		"aaaaaaaaaa",
+		"abababababa",
+		"foo,bar,,baz,",
+		"héllo, wörld ☃",
+		"\xff\xe2\x98",
+	}
+	for i := 0; i < 20; i++ {
+		data := make([]byte, rnd.Intn(64))
+		for j := range data {
+			data[j] = "abc"[rnd.Intn(3)]
+		}
+		datas = append(datas, string(data))
+	}
+
+	seps := []string{"", "a", ",", "aa", "ab", "aba", "abc", "bca", "cab", "aaaa", "☃", "\xe2\x98", "abababab"}
+
+	for _, data := range datas {
+		for i := 0; i < 4; i++ {
+			buf := splitRandomly(t, rnd, []byte(data))
+
+			for _, sep := range seps {
+				sep := []byte(sep)
+
+				idx, err := Index(buf, sep)
+				require.NoError(t, err)
+				assert.EqualValues(t, bytes.Index([]byte(data), sep), idx, "Index(%q, %q)", data, sep)
+
+				last, err := LastIndex(buf, sep)
+				require.NoError(t, err)
+				assert.EqualValues(t, bytes.LastIndex([]byte(data), sep), last, "LastIndex(%q, %q)", data, sep)
+
+				count, err := Count(buf, sep)
+				require.NoError(t, err)
+				assert.EqualValues(t, bytes.Count([]byte(data), sep), count, "Count(%q, %q)", data, sep)
+
+				contains, err := Contains(buf, sep)
+				require.NoError(t, err)
+				assert.Equal(t, bytes.Contains([]byte(data), sep), contains, "Contains(%q, %q)", data, sep)
+
+				prefix, err := HasPrefix(buf, sep)
+				require.NoError(t, err)
+				assert.Equal(t, bytes.HasPrefix([]byte(data), sep), prefix, "HasPrefix(%q, %q)", data, sep)
+
+				suffix, err := HasSuffix(buf, sep)
+				require.NoError(t, err)
+				assert.Equal(t, bytes.HasSuffix([]byte(data), sep), suffix, "HasSuffix(%q, %q)", data, sep)
+
+				parts, err := Split(buf, sep)
+				require.NoError(t, err)
+				expected := bytes.Split([]byte(data), sep)
+				if assert.Len(t, parts, len(expected), "Split(%q, %q)", data, sep) {
+					for j, part := range parts {
+						assert.Equal(t, string(expected[j]), mustReadAll(t, part), "Split(%q, %q)[%d]", data, sep, j)
+					}
+				}
+				closeAll(parts)
+			}
+
+			for _, c := range []byte("a,☃\xff") {
+				idx, err := IndexByte(buf, c)
+				require.NoError(t, err)
+				assert.EqualValues(t, bytes.IndexByte([]byte(data), c), idx, "IndexByte(%q, %q)", data, c)
+			}
+
+			buf.Close()
+		}
+	}
+}
+
+func TestSplitSurvivesClose(t *testing.T) {
+	buf, err := NewFromFile(makeTempFile(t, "foo\nbar\nbaz"))
+	require.NoError(t, err)
+
+	parts, err := Split(buf, []byte("\n"))
+	require.NoError(t, err)
+	require.NoError(t, buf.Close())
+
+	require.Len(t, parts, 3)
+	assert.Equal(t, "foo", mustReadAll(t, parts[0]))
+	assert.Equal(t, "bar", mustReadAll(t, parts[1]))
+	assert.Equal(t, "baz", mustReadAll(t, parts[2]))
+	closeAll(parts)
+}
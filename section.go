@@ -0,0 +1,99 @@
+package bytebuf
+
+import (
+	"errors"
+	"io"
+)
+
+var errNegativeOffset = errors.New("bytebuf: negative offset")
+
+// clampSection clamps the given offset and length to the bounds of a buffer
+// with the provided length.
+func clampSection(off, n, length int64) (int64, int64) {
+	if off < 0 {
+		off = 0
+	}
+	if off > length {
+		off = length
+	}
+	if n < 0 {
+		n = 0
+	}
+	if n > length-off {
+		n = length - off
+	}
+	return off, n
+}
+
+// sectionBuf is a ByteBuf that's a view over a range of another ByteBuf. It's
+// used for buffer types that have no more efficient way of representing a
+// section of themselves.
+type sectionBuf struct {
+	b   ByteBuf
+	off int64
+	n   int64
+
+	// The handle is shared between all sections of b, which is closed
+	// once all of them have been closed.
+	handle
+
+	digestCache
+}
+
+var _ ByteBuf = (*sectionBuf)(nil)
+
+// newSection returns a section of the provided ByteBuf, which must be a
+// handle that is owned by the section; it's closed once the returned ByteBuf
+// and all sections of it have been closed.
+func newSection(b ByteBuf, off, n int64) ByteBuf {
+	off, n = clampSection(off, n, b.Length())
+
+	ret := &sectionBuf{b: b, off: off, n: n}
+	ret.ref = newRefCount(b.Close)
+	return ret
+}
+
+// Length implements ByteBuf
+func (b *sectionBuf) Length() int64 {
+	return b.n
+}
+
+// AsReader implements ByteBuf
+func (b *sectionBuf) AsReader() *Reader {
+	return NewReader(b)
+}
+
+// WriteTo implements io.WriterTo
+func (b *sectionBuf) WriteTo(w io.Writer) (n int64, err error) {
+	return io.Copy(w, io.NewSectionReader(b.b, b.off, b.n))
+}
+
+// ReadAt implements io.ReaderAt
+func (b *sectionBuf) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+	if off >= b.n {
+		return 0, io.EOF
+	}
+
+	if max := b.n - off; int64(len(p)) > max {
+		n, err := b.b.ReadAt(p[:max], b.off+off)
+		if err == nil {
+			err = io.EOF
+		}
+		return n, err
+	}
+	return b.b.ReadAt(p, b.off+off)
+}
+
+// Section implements ByteBuf
+func (b *sectionBuf) Section(off, n int64) ByteBuf {
+	off, n = clampSection(off, n, b.n)
+	return &sectionBuf{b: b.b, off: b.off + off, n: n, handle: b.dup()}
+}
+
+// Close implements io.Closer
+func (b *sectionBuf) Close() error {
+	return b.close()
+}
@@ -0,0 +1,75 @@
+package bytebuf
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSection(t *testing.T) {
+	const expected = `foobarbazasdf`
+
+	sections := []struct {
+		Off, N int64
+	}{
+		{0, 13},
+		{0, 4},
+		{3, 5},
+		{4, 9},
+		{6, 100},
+	}
+
+	for _, impl := range byteBufImpls(t, expected) {
+		buf := impl.Buf
+		t.Run(impl.Name, func(t *testing.T) {
+			for _, sec := range sections {
+				sec := sec
+				t.Run(fmt.Sprintf("Off=%d,N=%d", sec.Off, sec.N), func(t *testing.T) {
+					end := sec.Off + sec.N
+					if end > int64(len(expected)) {
+						end = int64(len(expected))
+					}
+					testByteBufImpl(t, buf.Section(sec.Off, sec.N), expected[sec.Off:end])
+				})
+			}
+
+			t.Run("Nested", func(t *testing.T) {
+				testByteBufImpl(t, buf.Section(2, 10).Section(3, 5), expected[5:10])
+			})
+
+			t.Run("OutOfBounds", func(t *testing.T) {
+				sec := buf.Section(100, 5)
+				assert.EqualValues(t, 0, sec.Length())
+
+				n, err := sec.ReadAt(make([]byte, 1), 0)
+				assert.Equal(t, 0, n)
+				assert.Error(t, err)
+			})
+
+			t.Run("CloseSection", func(t *testing.T) {
+				// Closing a section must not affect the parent.
+				require.NoError(t, buf.Section(1, 2).Close())
+
+				data, err := ReadAll(buf)
+				if assert.NoError(t, err) {
+					assert.Equal(t, expected, string(data))
+				}
+			})
+		})
+	}
+}
+
+func TestSectionSliceZeroCopy(t *testing.T) {
+	data := []byte("foobarbaz")
+	buf := NewFromSlices(data[:3], data[3:])
+
+	sec, ok := buf.Section(1, 4).(*sliceBuf)
+	require.True(t, ok)
+	require.Len(t, sec.slices, 2)
+
+	// The sub-slices should point into the original data.
+	assert.Equal(t, &data[1], &sec.slices[0][0])
+	assert.Equal(t, &data[3], &sec.slices[1][0])
+}
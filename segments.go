@@ -0,0 +1,143 @@
+package bytebuf
+
+import (
+	"io"
+)
+
+// segmentReadSize is the size of the reads that walkSegments makes from
+// buffers that aren't backed by memory.
+const segmentReadSize = 1024 * 1024
+
+// walkSegments calls fn with each contiguous segment of the n bytes of b
+// starting at off, in order, stopping if fn returns an error. Data in memory
+// is passed to fn directly, without copying; other data is read in large
+// chunks into a temporary buffer, so fn must not retain the slice.
+func walkSegments(b ByteBuf, off, n int64, fn func(p []byte) error) error {
+	var w segmentWalker
+	return w.walk(b, off, n, fn)
+}
+
+// segmentWalker implements walkSegments, reusing the same temporary buffer
+// for all reads; this is useful when walking many small ranges of a buffer.
+type segmentWalker struct {
+	buf []byte
+}
+
+func (w *segmentWalker) walk(b ByteBuf, off, n int64, fn func(p []byte) error) error {
+	off, n = clampSection(off, n, b.Length())
+	if n == 0 {
+		return nil
+	}
+
+	switch v := b.(type) {
+	case *sliceBuf:
+		end := off + n
+		for i := v.find(off); i < len(v.slices) && v.offsets[i] < end; i++ {
+			slice := v.slices[i]
+			start := off - v.offsets[i]
+			if start < 0 {
+				start = 0
+			}
+			if stop := end - v.offsets[i]; stop < int64(len(slice)) {
+				slice = slice[:stop]
+			}
+
+			if err := fn(slice[start:]); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *combinedBuf:
+		end := off + n
+		for i := v.find(off); i < len(v.bufs) && v.offsets[i] < end; i++ {
+			start, stop := v.offsets[i], v.offsets[i+1]
+			if start < off {
+				start = off
+			}
+			if stop > end {
+				stop = end
+			}
+
+			err := w.walk(v.bufs[i], start-v.offsets[i], stop-start, fn)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *readAheadBuf:
+		end := off + n
+		for off < end {
+			if err := v.fill(off); err != nil {
+				return err
+			}
+
+			seg := v.window[off-v.windowOff:]
+			if int64(len(seg)) > end-off {
+				seg = seg[:end-off]
+			}
+			if err := fn(seg); err != nil {
+				return err
+			}
+			off += int64(len(seg))
+		}
+		return nil
+	}
+
+	// Otherwise, read the data in chunks.
+	if int64(len(w.buf)) < n && len(w.buf) < segmentReadSize {
+		size := int64(segmentReadSize)
+		if size > n {
+			size = n
+		}
+		w.buf = make([]byte, size)
+	}
+
+	for n > 0 {
+		p := w.buf
+		if int64(len(p)) > n {
+			p = p[:n]
+		}
+
+		read, err := b.ReadAt(p, off)
+		if read > 0 {
+			if ferr := fn(p[:read]); ferr != nil {
+				return ferr
+			}
+			off += int64(read)
+			n -= int64(read)
+		}
+
+		if err == io.EOF && n == 0 {
+			break
+		} else if err != nil {
+			return err
+		} else if read == 0 {
+			return io.ErrNoProgress
+		}
+	}
+	return nil
+}
+
+// inMemory returns whether all the data in b is directly accessible in
+// memory, such that walkSegments doesn't need to copy it. Data in a file's
+// mapping isn't counted, since it's copied out of the mapping so that a fault
+// from a truncated file can be recovered from; see guardMapping.
+func inMemory(b ByteBuf) bool {
+	switch v := b.(type) {
+	case *sliceBuf:
+		return true
+
+	case *combinedBuf:
+		for _, buf := range v.bufs {
+			if !inMemory(buf) {
+				return false
+			}
+		}
+		return true
+
+	default:
+		return false
+	}
+}
@@ -7,7 +7,7 @@ import (
 	"syscall"
 )
 
-func maybeSendfile(dst, src syscall.Conn, l int64) (int64, bool, error) {
+func maybeSendfile(dst, src syscall.Conn, off, l int64) (int64, bool, error) {
 	fConn, err := src.SyscallConn()
 	if err != nil {
 		return 0, false, nil
@@ -26,14 +26,16 @@ func maybeSendfile(dst, src syscall.Conn, l int64) (int64, bool, error) {
 		werr error
 	)
 	err = fConn.Read(func(fd uintptr) bool {
-		n, werr = sendfileFd(netConn, fd, l)
+		n, werr = sendfileFd(netConn, fd, off, l)
 		return true
 	})
 
-	// If we get ENOSYS or EINVAL from sendfile(2), then the kernel doesn't
-	// support the syscall, or the fd is in the wrong state; we didn't move
-	// any data.
-	if werr == syscall.ENOSYS || werr == syscall.EINVAL {
+	// If we get ENOSYS or EINVAL from sendfile(2) before moving any data,
+	// then the kernel doesn't support the syscall, or the fd is in the
+	// wrong state, so the caller should fall back to copying. Once some
+	// data has been moved, falling back would write it again, so the error
+	// is returned instead.
+	if n == 0 && (werr == syscall.ENOSYS || werr == syscall.EINVAL) {
 		return 0, false, nil
 	}
 
@@ -52,15 +54,35 @@ func maybeSendfile(dst, src syscall.Conn, l int64) (int64, bool, error) {
 // This is a variable so we can override it in testing.
 var maxSendfileSize int = 4 * 1024 * 1024
 
-func sendfileFd(dst syscall.RawConn, src uintptr, remain int64) (int64, error) {
+func sendfileFd(dst syscall.RawConn, src uintptr, offset, remain int64) (int64, error) {
+	return writeFdChunks(dst, remain, maxSendfileSize, func(fd uintptr, n int) (int, error) {
+		return syscall.Sendfile(int(fd), int(src), &offset, n)
+	})
+}
+
+// writeFdChunks writes remain bytes to dst by repeatedly calling write with
+// dst's fd and the size of the next chunk, which is at most max bytes; write
+// returns the number of bytes that it wrote. This implements the loop shared
+// by sendfile(2) and splice(2).
+//
+// write is retried immediately if it fails with EINTR. If it fails with
+// EAGAIN, the RawConn waits for dst to become writable before retrying it;
+// this only happens if dst is non-blocking, since the runtime can't wait for
+// other fds. If write returns 0 with no error before all the data has been
+// written, then the source is at EOF, and io.EOF is returned.
+func writeFdChunks(
+	dst syscall.RawConn,
+	remain int64,
+	max int,
+	write func(fd uintptr, n int) (int, error),
+) (int64, error) {
 	var (
-		offset  int64
 		written int64
 		err     error
 	)
 	for remain > 0 {
-		n := maxSendfileSize
-		if n > int(remain) {
+		n := max
+		if int64(n) > remain {
 			n = int(remain)
 		}
 
@@ -69,12 +91,12 @@ func sendfileFd(dst syscall.RawConn, src uintptr, remain int64) (int64, error) {
 			currWritten int
 		)
 		err = dst.Write(func(fd uintptr) bool {
-			currWritten, werr = syscall.Sendfile(
-				int(fd),
-				int(src),
-				&offset,
-				n,
-			)
+			for {
+				currWritten, werr = write(fd, n)
+				if werr != syscall.EINTR {
+					break
+				}
+			}
 
 			// Update lengths unconditionally
 			if currWritten > 0 {
@@ -82,21 +104,10 @@ func sendfileFd(dst syscall.RawConn, src uintptr, remain int64) (int64, error) {
 				remain -= int64(currWritten)
 			}
 
-			// 0-sized write but no error indicates an EOF; stop
-			// here.
-			if currWritten == 0 && werr == nil {
-				return true
-			}
-
-			// If this is an EINTR or EAGAIN, then we return false
-			// to signal that we should retry this function.
-			if werr == syscall.EINTR || werr == syscall.EAGAIN {
-				return false
-			}
-
-			// This is some other error; return true to stop
-			// iterating.
-			return true
+			// If this is an EAGAIN, then we return false to signal
+			// that we should wait and retry this function; any
+			// other result (including EOF) stops iterating.
+			return werr != syscall.EAGAIN
 		})
 		if err == nil {
 			err = werr
@@ -111,7 +122,7 @@ func sendfileFd(dst syscall.RawConn, src uintptr, remain int64) (int64, error) {
 		// yet hit 0 remaining bytes, then we reached EOF and we should
 		// return. We return 'io.EOF' to indicate that we wrote less
 		// than what we're expecting.
-		if currWritten == 0 && remain > 0 {
+		if currWritten <= 0 && remain > 0 {
 			return written, io.EOF
 		}
 	}
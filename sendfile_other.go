@@ -6,6 +6,6 @@ import (
 	"syscall"
 )
 
-func maybeSendfile(dst, src syscall.Conn, l int64) (n int64, handled bool, err error) {
+func maybeSendfile(dst, src syscall.Conn, off, l int64) (n int64, handled bool, err error) {
 	return 0, false, nil
 }
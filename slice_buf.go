@@ -1,14 +1,28 @@
 package bytebuf
 
 import (
-	"bytes"
 	"io"
+	"sort"
 )
 
 // sliceBuf is a ByteBuf that's backed by one or more slices of bytes.
 type sliceBuf struct {
 	slices      [][]byte
 	singleSlice [1][]byte
+
+	// offsets contains the offset of each slice within this buffer, and
+	// length is the total length of all slices; these are computed when
+	// the buffer is created.
+	offsets      []int64
+	singleOffset [1]int64
+	length       int64
+
+	// The handle refers to the resource that owns the memory backing
+	// slices, if any (e.g. the pooled chunks of a Builder); otherwise, it's
+	// the zero value.
+	handle
+
+	digestCache
 }
 
 var _ ByteBuf = (*sliceBuf)(nil)
@@ -16,10 +30,7 @@ var _ ByteBuf = (*sliceBuf)(nil)
 // NewFromSlice creates a ByteBuf from an underlying slice. This avoids an
 // extra allocation for the single-slice case compared to NewFromSlices.
 func NewFromSlice(b []byte) ByteBuf {
-	ret := &sliceBuf{}
-	ret.singleSlice[0] = b
-	ret.slices = ret.singleSlice[:]
-	return ret
+	return newSingleSliceBuf(b)
 }
 
 // NewFromString creates a ByteBuf from an underlying string. This is a
@@ -30,7 +41,39 @@ func NewFromString(s string) ByteBuf {
 
 // NewFromSlices creates a ByteBuf from multiple slices.
 func NewFromSlices(bs ...[]byte) ByteBuf {
-	ret := &sliceBuf{slices: bs}
+	return newSliceBuf(bs)
+}
+
+// newSliceBuf creates a sliceBuf from the provided slices, computing the
+// offset of each slice.
+func newSliceBuf(slices [][]byte) *sliceBuf {
+	ret := &sliceBuf{}
+	switch len(slices) {
+	case 0:
+		// Nothing to do
+
+	case 1:
+		return newSingleSliceBuf(slices[0])
+
+	default:
+		ret.slices = slices
+		ret.offsets = make([]int64, len(slices))
+		for i, slice := range slices {
+			ret.offsets[i] = ret.length
+			ret.length += int64(len(slice))
+		}
+	}
+	return ret
+}
+
+// newSingleSliceBuf creates a sliceBuf from a single slice, using the inline
+// arrays in the sliceBuf to avoid any allocations other than the sliceBuf
+// itself.
+func newSingleSliceBuf(b []byte) *sliceBuf {
+	ret := &sliceBuf{length: int64(len(b))}
+	ret.singleSlice[0] = b
+	ret.slices = ret.singleSlice[:]
+	ret.offsets = ret.singleOffset[:]
 	return ret
 }
 
@@ -40,43 +83,38 @@ func Empty() ByteBuf {
 }
 
 // Length implements ByteBuf
-func (b *sliceBuf) Length() (l int64) {
-	// TODO: cache?
-	for _, slice := range b.slices {
-		l += int64(len(slice))
-	}
-	return
+func (b *sliceBuf) Length() int64 {
+	return b.length
 }
 
-// AsReader implements ByteBuf
-func (b *sliceBuf) AsReader() io.Reader {
-	switch len(b.slices) {
-	case 0:
-		return bytes.NewReader(nil)
-
-	case 1:
-		return bytes.NewReader(b.slices[0])
-
-	default:
-		readers := make([]io.Reader, 0, len(b.slices))
-
-		for _, v := range b.slices {
-			readers = append(readers, bytes.NewReader(v))
-		}
+// find returns the index of the slice containing the given offset, or
+// len(b.slices) if the offset is past the end of this buffer.
+func (b *sliceBuf) find(off int64) int {
+	return sort.Search(len(b.slices), func(i int) bool {
+		return b.offsets[i]+int64(len(b.slices[i])) > off
+	})
+}
 
-		return io.MultiReader(readers...)
-	}
+// AsReader implements ByteBuf
+func (b *sliceBuf) AsReader() *Reader {
+	return NewReader(b)
 }
 
 // WriteTo implements io.WriterTo
 func (b *sliceBuf) WriteTo(w io.Writer) (n int64, err error) {
-	n, handled, err := maybeWritev(w, b.slices)
+	return writeSlices(w, b.slices)
+}
+
+// writeSlices writes all the provided slices to w, using vectored I/O if
+// possible.
+func writeSlices(w io.Writer, slices [][]byte) (n int64, err error) {
+	n, handled, err := maybeWritev(w, slices)
 	if handled {
 		return n, err
 	}
 
 	var currN int
-	for _, v := range b.slices {
+	for _, v := range slices {
 		currN, err = w.Write(v)
 		n += int64(currN)
 
@@ -89,57 +127,60 @@ func (b *sliceBuf) WriteTo(w io.Writer) (n int64, err error) {
 
 // ReadAt implements io.ReaderAt
 func (b *sliceBuf) ReadAt(p []byte, off int64) (int, error) {
-	offset := int(off)
-	copied := 0
-
-	// Walk through the slices to find the index of the first slice that has
-	// our data.
-	sliceIdx := -1
-	for i, slice := range b.slices {
-		if offset < len(slice) {
-			sliceIdx = i
-			break
-		}
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
 
-		offset -= len(slice)
+	// Find the index of the first slice that has our data, and then copy
+	// from it and subsequent slices until we either run out of slices or
+	// fill our buffer.
+	copied := 0
+	for i := b.find(off); i < len(b.slices) && len(p) > 0; i++ {
+		n := copy(p, b.slices[i][off-b.offsets[i]:])
+		copied += n
+		off += int64(n)
+		p = p[n:]
 	}
-	if sliceIdx == -1 {
-		return 0, io.EOF
+
+	if len(p) != 0 {
+		return copied, io.EOF
 	}
+	return copied, nil
+}
 
-	// Copy from the first slice
-	currSlice := b.slices[sliceIdx]
-	copyLen := len(p)
-	if offset+copyLen > len(currSlice) {
-		copyLen = len(currSlice) - offset
+// Section implements ByteBuf
+func (b *sliceBuf) Section(off, n int64) ByteBuf {
+	off, n = clampSection(off, n, b.Length())
+	if n == 0 {
+		return &sliceBuf{}
 	}
 
-	copied += copy(p, currSlice[offset:offset+copyLen])
-	p = p[copyLen:]
-	sliceIdx++
-
-	// Now, continue copying from adjacent slices until we either run out
-	// of slices or reach the end of our buffer.
-	for sliceIdx < len(b.slices) && len(p) > 0 {
-		slice := b.slices[sliceIdx]
-		copyLen = len(p)
-		if copyLen > len(slice) {
-			copyLen = len(slice)
+	// Collect sub-slices of the underlying slices, starting from the one
+	// containing our offset, until we have enough data; nothing is
+	// copied.
+	var slices [][]byte
+	i := b.find(off)
+	off -= b.offsets[i]
+	for ; n > 0; i++ {
+		slice := b.slices[i][off:]
+		if int64(len(slice)) > n {
+			slice = slice[:n]
 		}
 
-		copied += copy(p, slice[:copyLen])
-		p = p[copyLen:]
-		sliceIdx++
+		slices = append(slices, slice)
+		n -= int64(len(slice))
+		off = 0
 	}
 
-	if len(p) != 0 {
-		return copied, io.EOF
-	}
-	return copied, nil
+	ret := newSliceBuf(slices)
+	ret.handle = b.dup()
+	return ret
 }
 
 func (b *sliceBuf) Close() error {
 	b.slices = nil
 	b.singleSlice[0] = nil
-	return nil
+	b.offsets = nil
+	b.length = 0
+	return b.close()
 }
@@ -1,20 +1,20 @@
 package bytebuf
 
 import (
+	"io"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestSliceBuf(t *testing.T) {
-	b := &sliceBuf{
-		slices: [][]byte{
-			[]byte("foo"),
-			[]byte("b"),
-			[]byte("arbaz"),
-			[]byte("asdf"),
-		},
-	}
+	b := newSliceBuf([][]byte{
+		[]byte("foo"),
+		[]byte("b"),
+		[]byte("arbaz"),
+		[]byte("asdf"),
+	})
 
 	testByteBufImpl(t, b, "foobarbazasdf")
 }
@@ -28,3 +28,51 @@ func TestNewFromString(t *testing.T) {
 	const expected = "foobarbazasdf"
 	testByteBufImpl(t, NewFromString(expected), expected)
 }
+
+func TestSliceBufManySlices(t *testing.T) {
+	var (
+		slices   [][]byte
+		expected strings.Builder
+	)
+	for i := 0; i < 1000; i++ {
+		slice := []byte(strings.Repeat(string(rune('a'+i%26)), i%7))
+		slices = append(slices, slice)
+		expected.Write(slice)
+	}
+
+	buf := NewFromSlices(slices...)
+	exp := expected.String()
+	assert.EqualValues(t, len(exp), buf.Length())
+
+	for off := 0; off < len(exp); off += 13 {
+		for _, length := range []int{1, 5, 20} {
+			if off+length > len(exp) {
+				continue
+			}
+
+			p := make([]byte, length)
+			n, err := buf.ReadAt(p, int64(off))
+			if assert.NoError(t, err) {
+				assert.Equal(t, length, n)
+				assert.Equal(t, exp[off:off+length], string(p))
+			}
+		}
+	}
+
+	// Reading past the end should return a short read and io.EOF.
+	p := make([]byte, 10)
+	n, err := buf.ReadAt(p, int64(len(exp)-3))
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 3, n)
+}
+
+func TestNewFromSliceAllocs(t *testing.T) {
+	data := []byte("foobar")
+	allocs := testing.AllocsPerRun(100, func() {
+		buf := NewFromSlice(data)
+		if buf.Length() != int64(len(data)) {
+			t.Fatal("unexpected length")
+		}
+	})
+	assert.EqualValues(t, 1, allocs)
+}
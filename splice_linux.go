@@ -0,0 +1,86 @@
+// +build linux
+
+package bytebuf
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// maybeSplice copies data from a file to a pipe using splice(2).
+func maybeSplice(dst, src syscall.Conn, off, l int64) (int64, bool, error) {
+	fConn, err := src.SyscallConn()
+	if err != nil {
+		return 0, false, nil
+	}
+
+	pipeConn, err := dst.SyscallConn()
+	if err != nil {
+		return 0, false, nil
+	}
+
+	// A pipe that wasn't opened in non-blocking mode (e.g. a standard
+	// stream inherited from a shell pipeline) can't be waited on by the
+	// runtime, so we have to let splice(2) block instead; this is what a
+	// write(2) to the pipe would do anyway.
+	var (
+		flags int
+		ferr  error
+	)
+	err = pipeConn.Control(func(fd uintptr) {
+		flags, ferr = unix.FcntlInt(fd, unix.F_GETFL, 0)
+	})
+	if err != nil || ferr != nil {
+		return 0, false, nil
+	}
+	nonblock := flags&unix.O_NONBLOCK != 0
+
+	// As with sendfile, we don't retry reads from the source file.
+	var (
+		n    int64
+		werr error
+	)
+	err = fConn.Read(func(fd uintptr) bool {
+		n, werr = spliceFd(pipeConn, fd, off, l, nonblock)
+		return true
+	})
+
+	// If we get ENOSYS or EINVAL from splice(2) before moving any data,
+	// then the kernel doesn't support the syscall, or the destination
+	// isn't a pipe, so the caller should fall back to copying. Once some
+	// data has been moved, falling back would write it again, so the error
+	// is returned instead.
+	if n == 0 && (werr == syscall.ENOSYS || werr == syscall.EINVAL) {
+		return 0, false, nil
+	}
+
+	// Return either error, if we got one.
+	if err == nil {
+		err = werr
+	}
+
+	return n, true, err
+}
+
+// The amount of data that splice(2) can move in one call is limited by the
+// size of the pipe buffer, but we limit things further to prevent large
+// transfers from blocking too long.
+//
+// This is a variable so we can override it in testing.
+var maxSpliceSize int = 4 * 1024 * 1024
+
+func spliceFd(dst syscall.RawConn, src uintptr, offset, remain int64, nonblock bool) (int64, error) {
+	flags := unix.SPLICE_F_MOVE
+	if nonblock {
+		// Use SPLICE_F_NONBLOCK so that we get EAGAIN when the pipe is
+		// full, rather than blocking the thread; the RawConn will wait
+		// until the pipe is writable again.
+		flags |= unix.SPLICE_F_NONBLOCK
+	}
+
+	return writeFdChunks(dst, remain, maxSpliceSize, func(fd uintptr, n int) (int, error) {
+		sn, err := unix.Splice(int(src), &offset, int(fd), nil, n, flags)
+		return int(sn), err
+	})
+}
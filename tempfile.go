@@ -0,0 +1,84 @@
+package bytebuf
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+)
+
+// TempStorage selects how NewFromReaderWithOptions stores data that is
+// spilled out of memory.
+type TempStorage int
+
+const (
+	// TempStorageDefault uses the best unnamed storage available on this
+	// platform: TempStorageTmpfile if it's supported by the filesystem,
+	// falling back to TempStorageUnlinked.
+	TempStorageDefault TempStorage = iota
+
+	// TempStorageTmpfile creates an unnamed file in the spill directory
+	// with O_TMPFILE; see open(2). This is only supported on Linux.
+	TempStorageTmpfile
+
+	// TempStorageMemfd creates an anonymous memory-backed file with
+	// memfd_create(2); the spill directory is ignored. This is only
+	// supported on Linux.
+	TempStorageMemfd
+
+	// TempStorageUnlinked creates a named temporary file and removes it
+	// immediately after creation. On platforms that can't remove an open
+	// file, the file is instead removed when the ByteBuf is closed.
+	TempStorageUnlinked
+)
+
+// ErrStorageUnsupported is returned when the requested TempStorage is not
+// supported on this platform.
+var ErrStorageUnsupported = errors.New("bytebuf: temporary storage type not supported")
+
+// createTempFile creates a temporary file in the provided directory with the
+// given storage type. The file will be removed once it's closed, either by the
+// operating system or, if a non-empty path is returned, by removing that path
+// after closing the file.
+func createTempFile(dir string, storage TempStorage) (*os.File, string, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	switch storage {
+	case TempStorageDefault:
+		f, err := openTmpfile(dir)
+		if err == nil {
+			return f, "", nil
+		}
+		return createUnlinked(dir)
+
+	case TempStorageTmpfile:
+		f, err := openTmpfile(dir)
+		return f, "", err
+
+	case TempStorageMemfd:
+		f, err := openMemfd()
+		return f, "", err
+
+	case TempStorageUnlinked:
+		return createUnlinked(dir)
+
+	default:
+		return nil, "", ErrStorageUnsupported
+	}
+}
+
+// createUnlinked creates a named temporary file and removes it immediately,
+// or returns the path that should be removed after it's closed if the file
+// can't be removed while it's open.
+func createUnlinked(dir string) (*os.File, string, error) {
+	f, err := ioutil.TempFile(dir, "bytebuf")
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := os.Remove(f.Name()); err != nil {
+		return f, f.Name(), nil
+	}
+	return f, "", nil
+}
@@ -0,0 +1,21 @@
+// +build linux
+
+package bytebuf
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func openTmpfile(dir string) (*os.File, error) {
+	return os.OpenFile(dir, os.O_RDWR|unix.O_TMPFILE, 0600)
+}
+
+func openMemfd() (*os.File, error) {
+	fd, err := unix.MemfdCreate("bytebuf", unix.MFD_CLOEXEC)
+	if err != nil {
+		return nil, os.NewSyscallError("memfd_create", err)
+	}
+	return os.NewFile(uintptr(fd), "memfd:bytebuf"), nil
+}
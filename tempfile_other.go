@@ -0,0 +1,15 @@
+// +build !linux
+
+package bytebuf
+
+import (
+	"os"
+)
+
+func openTmpfile(dir string) (*os.File, error) {
+	return nil, ErrStorageUnsupported
+}
+
+func openMemfd() (*os.File, error) {
+	return nil, ErrStorageUnsupported
+}
@@ -0,0 +1,51 @@
+package bytebuf
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTempStorage(t *testing.T) {
+	const expected = "foobarbaz"
+
+	testCases := []struct {
+		Name    string
+		Storage TempStorage
+	}{
+		{"Default", TempStorageDefault},
+		{"Tmpfile", TempStorageTmpfile},
+		{"Memfd", TempStorageMemfd},
+		{"Unlinked", TempStorageUnlinked},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.Name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			// Use a wrapper type to avoid any specialization.
+			r := struct{ io.Reader }{strings.NewReader(expected)}
+			buf, err := NewFromReaderWithOptions(r, ReaderOptions{
+				Dir:     dir,
+				Storage: testCase.Storage,
+			})
+			if err == ErrStorageUnsupported {
+				t.Skipf("storage not supported on this platform")
+			}
+			require.NoError(t, err)
+
+			// Nothing should be left behind in the directory once
+			// the buffer is closed; on most platforms, nothing
+			// should be there to begin with.
+			testByteBufImpl(t, buf, expected)
+
+			entries, err := ioutil.ReadDir(dir)
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+}
@@ -9,24 +9,133 @@ import (
 // NewFromReader creates a ByteBuf from an io.Reader. It will buffer data to
 // disk in the provided directory.
 func NewFromReader(r io.Reader, dir string) (ByteBuf, error) {
+	return NewFromReaderWithOptions(r, ReaderOptions{Dir: dir})
+}
+
+// ReaderOptions controls how NewFromReaderWithOptions buffers data.
+type ReaderOptions struct {
+	// Dir is the directory that data will be spilled to; if empty, the
+	// default directory for temporary files is used.
+	Dir string
+
+	// MemoryThreshold is the maximum number of bytes that will be buffered
+	// in memory. If the reader contains more data than this, then all
+	// data will be spilled to a temporary file in Dir. If zero, all
+	// non-empty readers will be spilled to disk.
+	MemoryThreshold int64
+
+	// Storage controls how spilled data is stored. Regardless of the
+	// storage type, the spilled data is removed when the returned ByteBuf
+	// is closed.
+	Storage TempStorage
+
+	// Encrypt controls whether spilled data is encrypted. If set, data is
+	// encrypted with AES-GCM using a random key that's only stored in
+	// memory, in chunks that are decrypted as they're read; reading data
+	// that has been modified returns ErrTampered.
+	Encrypt bool
+}
+
+const (
+	// minSpoolChunkSize and maxSpoolChunkSize bound the size of the
+	// chunks that we read into while buffering data in memory; we start
+	// small, to avoid wasting memory for small readers, and double the
+	// chunk size each time we fill one.
+	minSpoolChunkSize = 512
+	maxSpoolChunkSize = 64 * 1024
+)
+
+// NewFromReaderWithOptions creates a ByteBuf from an io.Reader. Data is
+// buffered in memory until the reader is exhausted, in which case the
+// returned ByteBuf is backed by the buffered slices, or until the provided
+// MemoryThreshold is crossed, in which case all data is spilled to a temporary
+// file and the returned ByteBuf is backed by that file.
+func NewFromReaderWithOptions(r io.Reader, opts ReaderOptions) (ByteBuf, error) {
 	// See if this is a type that we can special-case.
 	switch v := r.(type) {
 	case *os.File:
 		return NewFromFile(v)
 	}
 
-	f, err := ioutil.TempFile(dir, "")
+	var (
+		slices    [][]byte
+		total     int64
+		chunkSize int64 = minSpoolChunkSize
+	)
+	for total < opts.MemoryThreshold {
+		size := chunkSize
+		if remain := opts.MemoryThreshold - total; size > remain {
+			size = remain
+		}
+
+		chunk := make([]byte, size)
+		n, err := io.ReadFull(r, chunk)
+		if n > 0 {
+			slices = append(slices, chunk[:n])
+			total += int64(n)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return NewFromSlices(slices...), nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		if chunkSize < maxSpoolChunkSize {
+			chunkSize *= 2
+		}
+	}
+
+	// We've buffered as much as we're allowed to; check whether there's
+	// any more data before spilling to disk.
+	var probe [1]byte
+	n, err := io.ReadFull(r, probe[:])
+	if err == io.EOF {
+		return NewFromSlices(slices...), nil
+	} else if err != nil {
+		return nil, err
+	}
+	slices = append(slices, probe[:n])
+
+	f, path, err := createTempFile(opts.Dir, opts.Storage)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = io.Copy(f, r)
+	var ret ByteBuf
+	if opts.Encrypt {
+		ret, err = spillEncrypted(f, path, slices, r)
+	} else {
+		ret, err = spill(f, path, slices, r)
+	}
 	if err != nil {
 		f.Close()
+		if path != "" {
+			os.Remove(path)
+		}
 		return nil, err
 	}
+	return ret, nil
+}
 
-	return NewFromFile(f)
+// spill writes the buffered slices and the remainder of the reader to the
+// provided file, and returns a fileBuf backed by it that removes the file at
+// the given path (if any) once closed.
+func spill(f *os.File, path string, slices [][]byte, r io.Reader) (*fileBuf, error) {
+	if _, err := NewFromSlices(slices...).WriteTo(f); err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		return nil, err
+	}
+
+	ret, err := newFileBuf(f)
+	if err != nil {
+		return nil, err
+	}
+	ret.path = path
+	return ret, nil
 }
 
 // ReadAll reads an entire ByteBuf into a byte slice and returns it. This may
@@ -41,7 +150,14 @@ func ReadAll(b ByteBuf) ([]byte, error) {
 		return ret, nil
 
 	case *fileBuf:
-		return ioutil.ReadAll(v.f)
+		// Read with ReadAt, since this buffer might be a section of the
+		// file and we shouldn't modify the file offset.
+		ret := make([]byte, int(v.size))
+		n, err := v.ReadAt(ret, 0)
+		if err == io.EOF {
+			err = nil
+		}
+		return ret[:n], err
 
 	default:
 		return ioutil.ReadAll(v.AsReader())
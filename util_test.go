@@ -3,6 +3,7 @@ package bytebuf
 import (
 	"bytes"
 	"io"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -23,6 +24,50 @@ func TestNewFromReader(t *testing.T) {
 	}
 }
 
+func TestNewFromReaderWithOptions(t *testing.T) {
+	largeData := strings.Repeat("i'm a data line\n", 10000)
+
+	testCases := []struct {
+		Name      string
+		Data      string
+		Threshold int64
+		InMemory  bool
+	}{
+		{"Empty", "", 0, true},
+		{"NoThreshold", "foobarbaz", 0, false},
+		{"BelowThreshold", "foobarbaz", 100, true},
+		{"AtThreshold", "foobarbaz", 9, true},
+		{"AboveThreshold", "foobarbaz", 8, false},
+		{"LargeBelowThreshold", largeData, int64(len(largeData)) + 1, true},
+		{"LargeAboveThreshold", largeData, int64(len(largeData)) / 2, false},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.Name, func(t *testing.T) {
+			// Use a wrapper type to avoid any specialization.
+			r := struct{ io.Reader }{strings.NewReader(testCase.Data)}
+
+			buf, err := NewFromReaderWithOptions(r, ReaderOptions{
+				Dir:             t.TempDir(),
+				MemoryThreshold: testCase.Threshold,
+			})
+			require.NoError(t, err)
+			defer buf.Close()
+
+			if testCase.InMemory {
+				assert.IsType(t, &sliceBuf{}, buf)
+			} else {
+				assert.IsType(t, &fileBuf{}, buf)
+			}
+
+			data, err := ReadAll(buf)
+			if assert.NoError(t, err) {
+				assert.Equal(t, testCase.Data, string(data))
+			}
+		})
+	}
+}
+
 func TestReadAll(t *testing.T) {
 	const expected = `foobarbaz`
 
@@ -37,7 +82,7 @@ func TestReadAll(t *testing.T) {
 	cbuf2 := NewFromSlice([]byte(expected[4:]))
 
 	// Note: can't use Append here since that special-cases bytes
-	combined := &combinedBuf{cbuf1, cbuf2}
+	combined := newCombinedBuf([]ByteBuf{cbuf1, cbuf2})
 
 	testCases := []struct {
 		Name string
@@ -0,0 +1,135 @@
+package bytebuf
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// writeAtChunkSize is the amount of data that each goroutine copies at once in
+// WriteAtTo.
+//
+// This is a variable so we can override it in testing.
+var writeAtChunkSize int64 = 4 * 1024 * 1024
+
+// WriteAtTo writes the data in b to dst, starting at offset off in dst, and
+// returns the number of bytes written. Different parts of b are written
+// concurrently by up to concurrency goroutines, each calling dst.WriteAt with
+// the computed offset; if concurrency is zero, runtime.GOMAXPROCS(0) is used.
+//
+// Data in memory is written without copying. If dst is an *os.File, then
+// parts of b that are backed by files are copied with copy_file_range(2), if
+// supported.
+//
+// If an error occurs, WriteAtTo stops as soon as possible and returns the
+// first error; since parts are written concurrently, the data that was
+// written may not be contiguous.
+func WriteAtTo(b ByteBuf, dst io.WriterAt, off int64, concurrency int) (int64, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+
+	length := b.Length()
+	numChunks := (length + writeAtChunkSize - 1) / writeAtChunkSize
+	if int64(concurrency) > numChunks {
+		concurrency = int(numChunks)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		next     int64 = -1
+		written  int64
+		errOnce  sync.Once
+		firstErr error
+		failed   int32
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			w := writeAtWorker{dst: dst}
+			for atomic.LoadInt32(&failed) == 0 {
+				chunk := atomic.AddInt64(&next, 1)
+				if chunk >= numChunks {
+					return
+				}
+
+				start := chunk * writeAtChunkSize
+				n := writeAtChunkSize
+				if start+n > length {
+					n = length - start
+				}
+
+				currN, err := w.write(b, start, n, off+start)
+				atomic.AddInt64(&written, currN)
+				if err == nil && currN < n {
+					err = io.ErrShortWrite
+				}
+				if err != nil {
+					errOnce.Do(func() { firstErr = err })
+					atomic.StoreInt32(&failed, 1)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return written, firstErr
+}
+
+// writeAtWorker writes parts of a buffer to a WriterAt, reusing the same
+// temporary buffer for data that isn't in memory.
+type writeAtWorker struct {
+	dst    io.WriterAt
+	walker segmentWalker
+}
+
+// write writes the n bytes of b starting at off to w.dst at dstOff.
+func (w *writeAtWorker) write(b ByteBuf, off, n, dstOff int64) (int64, error) {
+	switch v := b.(type) {
+	case *combinedBuf:
+		// Write each buffer separately, so that we can use
+		// copy_file_range(2) for any that are files.
+		var written int64
+		end := off + n
+		for i := v.find(off); i < len(v.bufs) && v.offsets[i] < end; i++ {
+			start, stop := v.offsets[i], v.offsets[i+1]
+			if start < off {
+				start = off
+			}
+			if stop > end {
+				stop = end
+			}
+
+			currN, err := w.write(v.bufs[i], start-v.offsets[i], stop-start, dstOff+written)
+			written += currN
+			if err != nil {
+				return written, err
+			}
+		}
+		return written, nil
+
+	case *fileBuf:
+		if f, ok := w.dst.(*os.File); ok {
+			written, handled, err := maybeCopyFileRangeAt(f, v.f, dstOff, v.off+off, n)
+			if handled {
+				return written, err
+			}
+		}
+	}
+
+	var written int64
+	err := w.walker.walk(b, off, n, func(p []byte) error {
+		currN, err := w.dst.WriteAt(p, dstOff+written)
+		written += int64(currN)
+		return err
+	})
+	return written, err
+}
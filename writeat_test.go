@@ -0,0 +1,97 @@
+package bytebuf
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memWriterAt is an in-memory io.WriterAt that's safe for concurrent use, and
+// fails writes that extend past failAt, if it's set.
+type memWriterAt struct {
+	mu     sync.Mutex
+	data   []byte
+	failAt int64
+}
+
+var errWriteAtFailed = errors.New("write failed")
+
+func (w *memWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.failAt > 0 && off+int64(len(p)) > w.failAt {
+		return 0, errWriteAtFailed
+	}
+	if end := off + int64(len(p)); end > int64(len(w.data)) {
+		w.data = append(w.data, make([]byte, end-int64(len(w.data)))...)
+	}
+	return copy(w.data[off:], p), nil
+}
+
+func TestWriteAtTo(t *testing.T) {
+	defer func(old int64) { writeAtChunkSize = old }(writeAtChunkSize)
+	writeAtChunkSize = 1000
+
+	rnd := rand.New(rand.NewSource(1))
+	data := make([]byte, 20000+17)
+	rnd.Read(data)
+
+	// A mix of in-memory and file-backed buffers, including a large file
+	// that spans many chunks and a gzip buffer that's neither.
+	file, err := NewFromFile(makeTempFile(t, string(data[3000:15000])))
+	require.NoError(t, err)
+	gz := mustNewFromGzip(t, NewFromSlice(gzipData(t, data[15000:], 6)), nil)
+	buf := Append(Append(splitRandomly(t, rnd, data[:3000]), file), gz)
+	defer buf.Close()
+
+	const prefix = "prefix"
+
+	t.Run("File", func(t *testing.T) {
+		for _, concurrency := range []int{0, 1, 4} {
+			dst := makeTempFile(t, prefix)
+			defer dst.Close()
+
+			n, err := WriteAtTo(buf, dst, int64(len(prefix)), concurrency)
+			require.NoError(t, err)
+			assert.EqualValues(t, len(data), n)
+
+			got, err := ioutil.ReadAll(io.NewSectionReader(dst, 0, 1<<30))
+			require.NoError(t, err)
+			assert.True(t, bytes.Equal(append([]byte(prefix), data...), got), "concurrency=%d", concurrency)
+		}
+	})
+
+	t.Run("WriterAt", func(t *testing.T) {
+		dst := &memWriterAt{data: []byte(prefix)}
+		n, err := WriteAtTo(buf, dst, int64(len(prefix)), 8)
+		require.NoError(t, err)
+		assert.EqualValues(t, len(data), n)
+		assert.True(t, bytes.Equal(append([]byte(prefix), data...), dst.data))
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		dst := &memWriterAt{failAt: 5000}
+		n, err := WriteAtTo(buf, dst, 0, 4)
+		assert.Equal(t, errWriteAtFailed, err)
+		assert.True(t, n < int64(len(data)), "n=%d", n)
+	})
+
+	t.Run("NegativeOffset", func(t *testing.T) {
+		_, err := WriteAtTo(buf, &memWriterAt{}, -1, 1)
+		assert.Equal(t, errNegativeOffset, err)
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		n, err := WriteAtTo(Empty(), &memWriterAt{}, 0, 0)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 0, n)
+	})
+}
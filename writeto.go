@@ -0,0 +1,180 @@
+package bytebuf
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// defaultWriteToChunkSize is the default amount of data that
+// WriteToWithOptions writes at once; it's the same as the amount that
+// sendfile(2) writes in one call.
+//
+// This is a variable so we can override it in testing.
+var defaultWriteToChunkSize int64 = 4 * 1024 * 1024
+
+// aLongTimeAgo is a deadline in the past, which is used to interrupt blocked
+// writes.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// writeDeadliner is implemented by destinations that support write deadlines,
+// such as a net.Conn or a pipe.
+type writeDeadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// WriteToOptions contains options for WriteToWithOptions.
+type WriteToOptions struct {
+	// ChunkSize is the maximum amount of data that's written with a single
+	// call to the WriteTo method of a section of the buffer; the context is
+	// checked and Progress is called between chunks. If zero, 4MiB is
+	// used.
+	ChunkSize int64
+
+	// Progress, if non-nil, is called after each chunk is written with the
+	// total number of bytes written so far.
+	Progress func(written int64)
+
+	// RateLimit, if non-nil, limits the rate at which data is written.
+	// Chunks are no larger than the bucket's burst size, and each chunk
+	// waits for enough tokens before it's written.
+	RateLimit *TokenBucket
+}
+
+// WriteToContext is like b.WriteTo(w), but stops writing if ctx is cancelled.
+// This is equivalent to calling WriteToWithOptions with the zero
+// WriteToOptions.
+func WriteToContext(ctx context.Context, b ByteBuf, w io.Writer) (n int64, err error) {
+	return WriteToWithOptions(ctx, b, w, WriteToOptions{})
+}
+
+// WriteToWithOptions is like b.WriteTo(w), but stops writing if ctx is
+// cancelled, and supports progress reporting and rate limiting. It returns
+// the number of bytes written to w and, if ctx was cancelled before all of
+// the data was written, ctx.Err().
+//
+// The data is written in chunks with b's WriteTo method, so that any
+// optimized implementations (e.g. sendfile or writev) are used, and ctx is
+// checked between chunks. If w supports write deadlines (e.g. a net.Conn),
+// then ctx's deadline is used as the write deadline, and cancelling ctx
+// interrupts a blocked write. If WriteToWithOptions changed the write
+// deadline in either of these ways, it clears the deadline when it returns;
+// any write deadline that the caller set beforehand is not restored. If ctx
+// has no deadline and isn't cancelled, the write deadline isn't changed.
+func WriteToWithOptions(ctx context.Context, b ByteBuf, w io.Writer, opts WriteToOptions) (n int64, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultWriteToChunkSize
+	}
+	if opts.RateLimit != nil && chunkSize > opts.RateLimit.Burst() {
+		chunkSize = opts.RateLimit.Burst()
+	}
+
+	if dw, ok := w.(writeDeadliner); ok && ctx.Done() != nil {
+		deadline, hasDeadline := ctx.Deadline()
+		if hasDeadline {
+			dw.SetWriteDeadline(deadline)
+		}
+
+		// Interrupt any blocked write when the context is cancelled.
+		var (
+			stop        = make(chan struct{})
+			done        = make(chan struct{})
+			interrupted bool
+		)
+		go func() {
+			defer close(done)
+			select {
+			case <-ctx.Done():
+				dw.SetWriteDeadline(aLongTimeAgo)
+				interrupted = true
+			case <-stop:
+			}
+		}()
+		defer func() {
+			close(stop)
+			<-done
+			if hasDeadline || interrupted {
+				dw.SetWriteDeadline(time.Time{})
+			}
+		}()
+	}
+
+	length := b.Length()
+	for n < length {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+
+		size := length - n
+		if size > chunkSize {
+			size = chunkSize
+		}
+		if opts.RateLimit != nil {
+			if err := opts.RateLimit.Wait(ctx, size); err != nil {
+				return n, err
+			}
+		}
+
+		currN, err := WriteRange(b, w, n, size)
+		n += currN
+
+		if opts.RateLimit != nil && currN < size {
+			opts.RateLimit.refund(size - currN)
+		}
+		if opts.Progress != nil && currN > 0 {
+			opts.Progress(n)
+		}
+
+		if err != nil {
+			// If the write failed because the context was
+			// cancelled, return that instead of the (deadline)
+			// error from the write.
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return n, ctxErr
+			}
+			if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+				return n, context.DeadlineExceeded
+			}
+			return n, err
+		}
+		if currN < size {
+			return n, io.ErrShortWrite
+		}
+	}
+	return n, nil
+}
+
+// WriteRange writes the n bytes of b starting at offset off to w, and returns
+// the number of bytes written. The offset and length are clamped to the bounds
+// of b, as with Section; a negative offset is an error.
+//
+// The data is written with the WriteTo method of a section of b, so any
+// optimized implementations (e.g. sendfile or copy_file_range) read directly
+// from the given offset.
+func WriteRange(b ByteBuf, w io.Writer, off, n int64) (int64, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+	if off == 0 && n >= b.Length() {
+		return b.WriteTo(w)
+	}
+
+	section := b.Section(off, n)
+	defer section.Close()
+	return section.WriteTo(w)
+}
+
+// WriteToFrom writes the data in b starting at offset off to w, and returns the
+// number of bytes written. It can be used to resume an interrupted WriteTo
+// from the number of bytes that it returned; see WriteRange.
+func WriteToFrom(b ByteBuf, w io.Writer, off int64) (int64, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+	return WriteRange(b, w, off, b.Length()-off)
+}
@@ -0,0 +1,293 @@
+package bytebuf
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cancellingWriter is an io.Writer that cancels a context after a number of
+// writes.
+type cancellingWriter struct {
+	buf    bytes.Buffer
+	cancel func()
+	writes int
+}
+
+func (w *cancellingWriter) Write(p []byte) (int, error) {
+	w.writes--
+	if w.writes == 0 {
+		w.cancel()
+	}
+	return w.buf.Write(p)
+}
+
+func TestWriteToContext(t *testing.T) {
+	defer func(old int64) { defaultWriteToChunkSize = old }(defaultWriteToChunkSize)
+	defaultWriteToChunkSize = 10
+
+	data := strings.Repeat("0123456789", 10)
+	file, err := NewFromFile(makeTempFile(t, data[50:]))
+	require.NoError(t, err)
+	buf := Append(NewFromString(data[:50]), file)
+	defer buf.Close()
+
+	t.Run("Complete", func(t *testing.T) {
+		var out bytes.Buffer
+		n, err := WriteToContext(context.Background(), buf, &out)
+		require.NoError(t, err)
+		assert.EqualValues(t, len(data), n)
+		assert.Equal(t, data, out.String())
+	})
+
+	t.Run("AlreadyCancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		var out bytes.Buffer
+		n, err := WriteToContext(ctx, buf, &out)
+		assert.Equal(t, context.Canceled, err)
+		assert.EqualValues(t, 0, n)
+		assert.Equal(t, 0, out.Len())
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// Cancel during the write of the first chunk in the file.
+		out := &cancellingWriter{cancel: cancel, writes: 6}
+		n, err := WriteToContext(ctx, buf, out)
+		assert.Equal(t, context.Canceled, err)
+		assert.EqualValues(t, 60, n)
+		assert.Equal(t, data[:60], out.buf.String())
+	})
+}
+
+func TestWriteToContextConn(t *testing.T) {
+	// Write a large file to a connection that isn't being read from, so
+	// that the write blocks once the socket buffers are full.
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1024*1024)
+	buf, err := NewFromFile(makeTempFile(t, string(data)))
+	require.NoError(t, err)
+	defer buf.Close()
+
+	tests := []struct {
+		Name     string
+		Context  func() (context.Context, context.CancelFunc)
+		Expected error
+	}{
+		{"Deadline", func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 200*time.Millisecond)
+		}, context.DeadlineExceeded},
+		{"Cancel", func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(200*time.Millisecond, cancel)
+			return ctx, cancel
+		}, context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "localhost:0")
+			require.NoError(t, err)
+			defer l.Close()
+
+			conn, err := net.Dial("tcp", l.Addr().String())
+			require.NoError(t, err)
+			defer conn.Close()
+
+			peer, err := l.Accept()
+			require.NoError(t, err)
+			defer peer.Close()
+
+			ctx, cancel := tt.Context()
+			defer cancel()
+
+			n, err := WriteToContext(ctx, buf, conn)
+			assert.Equal(t, tt.Expected, err)
+			assert.True(t, n > 0 && n < buf.Length(), "n=%d", n)
+
+			// The returned count is exactly what the peer receives,
+			// and the connection is still usable.
+			_, err = conn.Write([]byte("end"))
+			require.NoError(t, err)
+			conn.Close()
+
+			received, err := ioutil.ReadAll(peer)
+			require.NoError(t, err)
+			require.EqualValues(t, n+3, len(received))
+			assert.True(t, bytes.Equal(data[:n], received[:n]))
+			assert.Equal(t, "end", string(received[n:]))
+		})
+	}
+}
+
+func TestWriteToWithOptions(t *testing.T) {
+	data := strings.Repeat("0123456789", 10*1024)
+	file, err := NewFromFile(makeTempFile(t, data[50:]))
+	require.NoError(t, err)
+	buf := Append(NewFromString(data[:50]), file)
+	defer buf.Close()
+
+	t.Run("Progress", func(t *testing.T) {
+		var (
+			out      bytes.Buffer
+			progress []int64
+		)
+		n, err := WriteToWithOptions(context.Background(), buf, &out, WriteToOptions{
+			ChunkSize: 30000,
+			Progress: func(written int64) {
+				progress = append(progress, written)
+			},
+		})
+		require.NoError(t, err)
+		assert.EqualValues(t, len(data), n)
+		assert.Equal(t, data, out.String())
+		assert.Equal(t, []int64{30000, 60000, 90000, 102400}, progress)
+	})
+
+	t.Run("RateLimit", func(t *testing.T) {
+		// The bucket starts with 20KB, and the remaining 80KB take
+		// 0.4s at 200KB/s; chunks are limited to the burst size.
+		var progress []int64
+		start := time.Now()
+		tb := NewTokenBucket(200*1000, 20*1000)
+		opts := WriteToOptions{
+			RateLimit: tb,
+			Progress: func(written int64) {
+				progress = append(progress, written)
+			},
+		}
+		assertCopyViaConn(t, writerToFunc(func(w io.Writer) (int64, error) {
+			return WriteToWithOptions(context.Background(), buf, w, opts)
+		}), data)
+
+		elapsed := time.Since(start)
+		assert.True(t, elapsed >= 350*time.Millisecond, "elapsed: %v", elapsed)
+		assert.Len(t, progress, 6)
+		assert.EqualValues(t, 20000, progress[0])
+	})
+
+	t.Run("RateLimitCancelled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		// After the first chunk, the next one would take 10s.
+		var out bytes.Buffer
+		n, err := WriteToWithOptions(ctx, buf, &out, WriteToOptions{
+			RateLimit: NewTokenBucket(1000, 10000),
+		})
+		assert.Equal(t, context.DeadlineExceeded, err)
+		assert.EqualValues(t, 10000, n)
+		assert.Equal(t, data[:10000], out.String())
+	})
+}
+
+func TestWriteRange(t *testing.T) {
+	const data = "hello world, this is some data"
+
+	ranges := []struct {
+		Off, N   int64
+		Expected string
+	}{
+		{0, 30, data},
+		{6, 5, "world"},
+		{13, 100, data[13:]},
+		{30, 10, ""},
+		{40, 10, ""},
+	}
+
+	for _, impl := range byteBufImpls(t, data) {
+		buf := impl.Buf
+		t.Run(impl.Name, func(t *testing.T) {
+			for _, r := range ranges {
+				r := r
+				writeRange := writerToFunc(func(w io.Writer) (int64, error) {
+					return WriteRange(buf, w, r.Off, r.N)
+				})
+
+				var out bytes.Buffer
+				n, err := writeRange.WriteTo(&out)
+				require.NoError(t, err)
+				assert.EqualValues(t, len(r.Expected), n)
+				assert.Equal(t, r.Expected, out.String())
+
+				assertCopyViaConn(t, writeRange, r.Expected)
+				assertCopyViaPipe(t, writeRange, r.Expected)
+			}
+
+			_, err := WriteRange(buf, ioutil.Discard, -1, 10)
+			assert.Equal(t, errNegativeOffset, err)
+			_, err = WriteToFrom(buf, ioutil.Discard, -1)
+			assert.Equal(t, errNegativeOffset, err)
+		})
+	}
+}
+
+func TestWriteToFromResume(t *testing.T) {
+	data := strings.Repeat("0123456789", 1000)
+	buf, err := NewFromFile(makeTempFile(t, data))
+	require.NoError(t, err)
+	defer buf.Close()
+
+	// Fail partway through the first attempt...
+	w := &limitedWriter{limit: 1234}
+	n, err := buf.WriteTo(w)
+	assert.Equal(t, errLimitReached, err)
+	assert.EqualValues(t, 1234, n)
+
+	// ... and resume from where it left off, writing the rest to a file
+	// (which uses copy_file_range, where supported).
+	f := makeTempFile(t, w.buf.String())
+	defer f.Close()
+	_, err = f.Seek(0, io.SeekEnd)
+	require.NoError(t, err)
+
+	rest, err := WriteToFrom(buf, f, n)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(data)-1234, rest)
+
+	written, err := ioutil.ReadAll(io.NewSectionReader(f, 0, int64(len(data))+1))
+	require.NoError(t, err)
+	assert.Equal(t, data, string(written))
+}
+
+func TestWriteToContextKeepsDeadline(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	peer, err := l.Accept()
+	require.NoError(t, err)
+	defer peer.Close()
+
+	// A context without a deadline doesn't clear the caller's write
+	// deadline, unless it's cancelled.
+	require.NoError(t, conn.SetWriteDeadline(time.Now().Add(100*time.Millisecond)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n, err := WriteToContext(ctx, NewFromString("hello"), conn)
+	require.NoError(t, err)
+	assert.EqualValues(t, 5, n)
+
+	time.Sleep(150 * time.Millisecond)
+	_, err = conn.Write([]byte("world"))
+	if assert.Error(t, err) {
+		netErr, ok := err.(net.Error)
+		assert.True(t, ok && netErr.Timeout(), "err: %v", err)
+	}
+}
@@ -7,5 +7,7 @@ import (
 )
 
 func maybeWritev(w io.Writer, slices [][]byte) (int64, bool, error) {
-	return 0, false, nil
+	// We don't have a writev(2) implementation on this platform, but the
+	// net package might; use it for network connections.
+	return writevNetBuffers(w, slices)
 }
@@ -0,0 +1,51 @@
+package bytebuf
+
+import (
+	"io"
+	"net"
+)
+
+// writevNetBuffers writes the provided slices to w if it's a net.Conn, using
+// net.Buffers; this uses vectored I/O on platforms where the net package
+// supports it, and falls back to a Write per slice otherwise.
+func writevNetBuffers(w io.Writer, slices [][]byte) (int64, bool, error) {
+	if _, ok := w.(net.Conn); !ok {
+		return 0, false, nil
+	}
+
+	// Copy the slices, since net.Buffers.WriteTo consumes them.
+	bufs := make(net.Buffers, len(slices))
+	copy(bufs, slices)
+
+	n, err := bufs.WriteTo(w)
+	return n, true, err
+}
+
+// NetBuffers returns a net.Buffers containing the data in an in-memory
+// ByteBuf, without copying the data, which can be used to write the ByteBuf
+// using vectored I/O. It returns false if b is not entirely backed by memory.
+//
+// The returned slices share memory with b, so they must not be modified, and
+// are only valid so long as b has not been closed.
+func NetBuffers(b ByteBuf) (net.Buffers, bool) {
+	switch v := b.(type) {
+	case *sliceBuf:
+		bufs := make(net.Buffers, len(v.slices))
+		copy(bufs, v.slices)
+		return bufs, true
+
+	case *combinedBuf:
+		var bufs net.Buffers
+		for _, child := range v.bufs {
+			s, ok := child.(*sliceBuf)
+			if !ok {
+				return nil, false
+			}
+			bufs = append(bufs, s.slices...)
+		}
+		return bufs, true
+
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,101 @@
+package bytebuf
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writerToFunc adapts a function to an io.WriterTo.
+type writerToFunc func(w io.Writer) (int64, error)
+
+func (f writerToFunc) WriteTo(w io.Writer) (int64, error) {
+	return f(w)
+}
+
+func TestWritevNetBuffers(t *testing.T) {
+	slices := [][]byte{
+		[]byte("foo"),
+		nil,
+		[]byte("bar"),
+		[]byte("baz"),
+	}
+
+	// Force the portable path, regardless of the platform.
+	writeTo := writerToFunc(func(w io.Writer) (int64, error) {
+		n, handled, err := writevNetBuffers(w, slices)
+		assert.True(t, handled)
+		return n, err
+	})
+
+	assertCopyViaConn(t, writeTo, "foobarbaz")
+	assertCopyViaUnixConn(t, writeTo, "foobarbaz")
+
+	// The slices must not be modified by writing.
+	assert.Equal(t, []byte("foo"), slices[0])
+
+	// Non-network writers aren't handled.
+	_, handled, err := writevNetBuffers(&bytes.Buffer{}, slices)
+	assert.NoError(t, err)
+	assert.False(t, handled)
+}
+
+func TestNetBuffers(t *testing.T) {
+	t.Run("Slice", func(t *testing.T) {
+		buf := NewFromSlices([]byte("foo"), []byte("bar"))
+
+		bufs, ok := NetBuffers(buf)
+		require.True(t, ok)
+		assert.Len(t, bufs, 2)
+
+		var out bytes.Buffer
+		_, err := bufs.WriteTo(&out)
+		require.NoError(t, err)
+		assert.Equal(t, "foobar", out.String())
+
+		// Writing the net.Buffers must not affect the ByteBuf.
+		assert.Equal(t, "foobar", mustReadAll(t, buf))
+	})
+
+	t.Run("Combined", func(t *testing.T) {
+		var b Builder
+		_, err := b.WriteString("foo")
+		require.NoError(t, err)
+		buf := Append(b.Freeze(), NewFromString("bar"))
+		defer buf.Close()
+
+		bufs, ok := NetBuffers(buf)
+		require.True(t, ok)
+
+		var out bytes.Buffer
+		_, err = bufs.WriteTo(&out)
+		require.NoError(t, err)
+		assert.Equal(t, "foobar", out.String())
+	})
+
+	t.Run("File", func(t *testing.T) {
+		f := makeTempFile(t, "foobar")
+		buf, err := NewFromFile(f)
+		require.NoError(t, err)
+		defer buf.Close()
+
+		_, ok := NetBuffers(buf)
+		assert.False(t, ok)
+
+		_, ok = NetBuffers(Append(NewFromString("foo"), Retain(buf)))
+		assert.False(t, ok)
+	})
+
+	t.Run("Section", func(t *testing.T) {
+		bufs, ok := NetBuffers(NewFromString("foobarbaz").Section(3, 3))
+		require.True(t, ok)
+
+		var out bytes.Buffer
+		_, err := bufs.WriteTo(&out)
+		require.NoError(t, err)
+		assert.Equal(t, "bar", out.String())
+	})
+}
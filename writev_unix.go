@@ -13,6 +13,13 @@ import (
 	"unsafe"
 )
 
+// maxIovecs is the maximum number of iovecs that we pass to a single writev(2)
+// call; passing more than IOV_MAX (which is 1024 on both Linux and Darwin)
+// fails with EINVAL.
+//
+// This is a variable so we can override it in testing.
+var maxIovecs = 1024
+
 func maybeWritev(w io.Writer, slices [][]byte) (int64, bool, error) {
 	var (
 		conn syscall.RawConn
@@ -25,6 +32,9 @@ func maybeWritev(w io.Writer, slices [][]byte) (int64, bool, error) {
 	case *net.TCPConn:
 		conn, err = v.SyscallConn()
 
+	case *net.UnixConn:
+		conn, err = v.SyscallConn()
+
 	default:
 		return 0, false, nil
 	}
@@ -32,45 +42,73 @@ func maybeWritev(w io.Writer, slices [][]byte) (int64, bool, error) {
 		return 0, false, err
 	}
 
-	iovec := make([]syscall.Iovec, 0, len(slices))
+	// Copy the non-empty slices, since we modify this as we write.
+	remaining := make([][]byte, 0, len(slices))
 	for _, slice := range slices {
-		if len(slice) == 0 {
-			continue
+		if len(slice) > 0 {
+			remaining = append(remaining, slice)
 		}
-
-		iovec = append(iovec, syscall.Iovec{
-			Base: &slice[0],
-			Len:  uint64(len(slice)),
-		})
-	}
-
-	// Don't make a syscall for a zero-length write
-	if len(iovec) == 0 {
-		return 0, true, nil
 	}
 
 	var (
-		n     uintptr
-		errno syscall.Errno
+		written int64
+		iovec   []syscall.Iovec
 	)
-	err = conn.Write(func(fd uintptr) bool {
-		n, _, errno = syscall.Syscall(
-			syscall.SYS_WRITEV,
-			fd,
-			uintptr(unsafe.Pointer(&iovec[0])),
-			uintptr(len(iovec)),
+	for len(remaining) > 0 {
+		// Write up to maxIovecs slices at a time.
+		iovec = iovec[:0]
+		for _, slice := range remaining {
+			if len(iovec) == maxIovecs {
+				break
+			}
+
+			iov := syscall.Iovec{Base: &slice[0]}
+			iov.SetLen(len(slice))
+			iovec = append(iovec, iov)
+		}
+
+		var (
+			n     uintptr
+			errno syscall.Errno
 		)
+		err = conn.Write(func(fd uintptr) bool {
+			n, _, errno = syscall.Syscall(
+				syscall.SYS_WRITEV,
+				fd,
+				uintptr(unsafe.Pointer(&iovec[0])),
+				uintptr(len(iovec)),
+			)
+
+			// Retry if we're interrupted or would block; the conn.Write
+			// function will wait for writes to be available.
+			if errno == syscall.EINTR || errno == syscall.EAGAIN {
+				return false
+			}
+			return true
+		})
+		if err == nil && errno != 0 {
+			err = fmt.Errorf("writev failed with error: %d", errno)
+		}
+		if err != nil {
+			return written, true, err
+		}
+		if n == 0 {
+			return written, true, io.ErrShortWrite
+		}
+		written += int64(n)
+
+		// The write may have been partial; skip past everything that
+		// was written and continue with the rest.
+		for n > 0 {
+			if uintptr(len(remaining[0])) > n {
+				remaining[0] = remaining[0][n:]
+				break
+			}
 
-		// Retry if we're interrupted or would block; the conn.Write
-		// function will wait for writes to be available.
-		if errno == syscall.EINTR || errno == syscall.EAGAIN {
-			return false
+			n -= uintptr(len(remaining[0]))
+			remaining = remaining[1:]
 		}
-		return true
-	})
-	if err == nil && errno != 0 {
-		err = fmt.Errorf("writev failed with error: %d", errno)
 	}
 
-	return int64(n), true, err
+	return written, true, nil
 }
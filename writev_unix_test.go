@@ -0,0 +1,55 @@
+// +build linux darwin
+
+package bytebuf
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestWritevManySlices(t *testing.T) {
+	oldMax := maxIovecs
+	maxIovecs = 16
+	t.Cleanup(func() {
+		maxIovecs = oldMax
+	})
+
+	// Use more slices than fit in a single writev(2) call.
+	var (
+		slices   [][]byte
+		expected strings.Builder
+	)
+	for i := 0; i < 100; i++ {
+		slice := []byte(fmt.Sprintf("slice %d;", i))
+		slices = append(slices, slice, nil)
+		expected.Write(slice)
+	}
+
+	testByteBufImpl(t, NewFromSlices(slices...), expected.String())
+}
+
+func TestWritevPartialWrites(t *testing.T) {
+	// Write enough data that the socket buffer fills up, which results in
+	// partial writes from writev(2).
+	var (
+		slices   [][]byte
+		expected strings.Builder
+	)
+	for i := 0; i < 3000; i++ {
+		slice := []byte(strings.Repeat(fmt.Sprintf("%d,", i%10), 1000))
+		slices = append(slices, slice)
+		expected.Write(slice)
+	}
+
+	buf := NewFromSlices(slices...)
+	t.Run("TCP", func(t *testing.T) {
+		assertCopyViaConn(t, buf, expected.String())
+	})
+	t.Run("Unix", func(t *testing.T) {
+		assertCopyViaUnixConn(t, buf, expected.String())
+	})
+	t.Run("Pipe", func(t *testing.T) {
+		assertCopyViaPipe(t, buf, expected.String())
+	})
+}